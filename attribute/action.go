@@ -0,0 +1,562 @@
+package attribute
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+type Kind int
+
+const (
+	Inherited Kind = iota
+	Synthesized
+)
+
+func (k Kind) ToString() string {
+	if k == Inherited {
+		return "inh"
+	}
+	return "syn"
+}
+
+type Decl struct {
+	Name string
+	Kind Kind
+}
+
+type Value interface{}
+
+type Func func(args []Value) (Value, error)
+
+// Ref addresses an attribute of a production symbol: $0 is the left-hand
+// side, $1..$n are the right-hand side symbols in order.
+type Ref struct {
+	Index int
+	Name  string
+}
+
+func (r Ref) ToString() string {
+	return fmt.Sprintf("$%d.%s", r.Index, r.Name)
+}
+
+type Equation struct {
+	Target Ref
+	Value  expr
+}
+
+type expr interface {
+	refs(res []Ref) []Ref
+}
+
+type intLit struct {
+	value int
+}
+
+type strLit struct {
+	value string
+}
+
+type refExpr struct {
+	ref Ref
+}
+
+type unaryExpr struct {
+	op rune
+	x  expr
+}
+
+type binaryExpr struct {
+	op   rune
+	x, y expr
+}
+
+type callExpr struct {
+	name string
+	args []expr
+}
+
+func (e intLit) refs(res []Ref) []Ref  { return res }
+func (e strLit) refs(res []Ref) []Ref  { return res }
+func (e refExpr) refs(res []Ref) []Ref { return append(res, e.ref) }
+func (e unaryExpr) refs(res []Ref) []Ref {
+	return e.x.refs(res)
+}
+func (e binaryExpr) refs(res []Ref) []Ref {
+	return e.y.refs(e.x.refs(res))
+}
+func (e callExpr) refs(res []Ref) []Ref {
+	for _, a := range e.args {
+		res = a.refs(res)
+	}
+	return res
+}
+
+const (
+	tokEOF = iota
+	tokRef
+	tokIdent
+	tokInt
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind int
+	text string
+	num  int
+}
+
+type scanner struct {
+	src []rune
+	pos int
+	tok token
+}
+
+func newScanner(src string) (*scanner, error) {
+	s := &scanner{
+		src: []rune(src),
+	}
+	return s, s.next()
+}
+
+func (s *scanner) next() error {
+	for s.pos < len(s.src) && unicode.IsSpace(s.src[s.pos]) {
+		s.pos++
+	}
+
+	if s.pos >= len(s.src) {
+		s.tok = token{kind: tokEOF}
+		return nil
+	}
+
+	start := s.pos
+	c := s.src[s.pos]
+	switch {
+	case c == '$':
+		s.pos++
+		for s.pos < len(s.src) && unicode.IsDigit(s.src[s.pos]) {
+			s.pos++
+		}
+		if s.pos == start+1 {
+			return fmt.Errorf("expected symbol index after $ at %d", start)
+		}
+		n, _ := strconv.Atoi(string(s.src[start+1 : s.pos]))
+		s.tok = token{kind: tokRef, text: string(s.src[start:s.pos]), num: n}
+	case unicode.IsDigit(c):
+		for s.pos < len(s.src) && unicode.IsDigit(s.src[s.pos]) {
+			s.pos++
+		}
+		n, err := strconv.Atoi(string(s.src[start:s.pos]))
+		if err != nil {
+			return err
+		}
+		s.tok = token{kind: tokInt, text: string(s.src[start:s.pos]), num: n}
+	case unicode.IsLetter(c) || c == '_':
+		for s.pos < len(s.src) && (unicode.IsLetter(s.src[s.pos]) || unicode.IsDigit(s.src[s.pos]) || s.src[s.pos] == '_') {
+			s.pos++
+		}
+		s.tok = token{kind: tokIdent, text: string(s.src[start:s.pos])}
+	case c == '\'':
+		s.pos++
+		for s.pos < len(s.src) && s.src[s.pos] != '\'' {
+			s.pos++
+		}
+		if s.pos >= len(s.src) {
+			return fmt.Errorf("unterminated string at %d", start)
+		}
+		s.pos++
+		s.tok = token{kind: tokString, text: string(s.src[start+1 : s.pos-1])}
+	default:
+		s.pos++
+		s.tok = token{kind: tokPunct, text: string(c)}
+	}
+
+	return nil
+}
+
+func (s *scanner) expect(text string) error {
+	if s.tok.kind != tokPunct || s.tok.text != text {
+		return fmt.Errorf("expected %q, got %q", text, s.tok.text)
+	}
+	return s.next()
+}
+
+func (s *scanner) isPunct(text string) bool {
+	return s.tok.kind == tokPunct && s.tok.text == text
+}
+
+// ParseDecls parses an attribute declaration such as "inh acc; syn val, len".
+func ParseDecls(src string) ([]Decl, error) {
+	s, err := newScanner(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Decl
+	for s.tok.kind != tokEOF {
+		if s.isPunct(";") {
+			if err := s.next(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var kind Kind
+		switch s.tok.text {
+		case "inh":
+			kind = Inherited
+		case "syn":
+			kind = Synthesized
+		default:
+			return nil, fmt.Errorf("expected inh or syn, got %q", s.tok.text)
+		}
+		if err := s.next(); err != nil {
+			return nil, err
+		}
+
+		for {
+			if s.tok.kind != tokIdent {
+				return nil, fmt.Errorf("expected attribute name, got %q", s.tok.text)
+			}
+			res = append(res, Decl{
+				Name: s.tok.text,
+				Kind: kind,
+			})
+			if err := s.next(); err != nil {
+				return nil, err
+			}
+			if !s.isPunct(",") {
+				break
+			}
+			if err := s.next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// ParseAction parses semantic equations such as "$2.acc = $1.val; $0.val = $2.val".
+func ParseAction(src string) ([]Equation, error) {
+	s, err := newScanner(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Equation
+	for s.tok.kind != tokEOF {
+		if s.isPunct(";") {
+			if err := s.next(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if s.tok.kind != tokRef {
+			return nil, fmt.Errorf("expected attribute reference, got %q", s.tok.text)
+		}
+		target, err := parseRef(s)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.expect("="); err != nil {
+			return nil, err
+		}
+		value, err := parseSum(s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, Equation{
+			Target: target,
+			Value:  value,
+		})
+
+		if s.tok.kind != tokEOF && !s.isPunct(";") {
+			return nil, fmt.Errorf("expected ';', got %q", s.tok.text)
+		}
+	}
+
+	return res, nil
+}
+
+func parseRef(s *scanner) (Ref, error) {
+	ref := Ref{
+		Index: s.tok.num,
+	}
+	if err := s.next(); err != nil {
+		return Ref{}, err
+	}
+	if err := s.expect("."); err != nil {
+		return Ref{}, err
+	}
+	if s.tok.kind != tokIdent {
+		return Ref{}, fmt.Errorf("expected attribute name, got %q", s.tok.text)
+	}
+	ref.Name = s.tok.text
+	return ref, s.next()
+}
+
+func parseSum(s *scanner) (expr, error) {
+	x, err := parseProduct(s)
+	if err != nil {
+		return nil, err
+	}
+
+	for s.isPunct("+") || s.isPunct("-") {
+		op := rune(s.tok.text[0])
+		if err := s.next(); err != nil {
+			return nil, err
+		}
+		y, err := parseProduct(s)
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: op, x: x, y: y}
+	}
+
+	return x, nil
+}
+
+func parseProduct(s *scanner) (expr, error) {
+	x, err := parseUnary(s)
+	if err != nil {
+		return nil, err
+	}
+
+	for s.isPunct("*") || s.isPunct("/") || s.isPunct("%") {
+		op := rune(s.tok.text[0])
+		if err := s.next(); err != nil {
+			return nil, err
+		}
+		y, err := parseUnary(s)
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: op, x: x, y: y}
+	}
+
+	return x, nil
+}
+
+func parseUnary(s *scanner) (expr, error) {
+	if s.isPunct("-") {
+		if err := s.next(); err != nil {
+			return nil, err
+		}
+		x, err := parseUnary(s)
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: '-', x: x}, nil
+	}
+
+	return parsePrimary(s)
+}
+
+func parsePrimary(s *scanner) (expr, error) {
+	switch s.tok.kind {
+	case tokInt:
+		e := intLit{value: s.tok.num}
+		return e, s.next()
+	case tokString:
+		e := strLit{value: s.tok.text}
+		return e, s.next()
+	case tokRef:
+		ref, err := parseRef(s)
+		if err != nil {
+			return nil, err
+		}
+		return refExpr{ref: ref}, nil
+	case tokIdent:
+		call := callExpr{name: s.tok.text}
+		if err := s.next(); err != nil {
+			return nil, err
+		}
+		if err := s.expect("("); err != nil {
+			return nil, err
+		}
+		for !s.isPunct(")") {
+			arg, err := parseSum(s)
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if !s.isPunct(",") {
+				break
+			}
+			if err := s.next(); err != nil {
+				return nil, err
+			}
+		}
+		return call, s.expect(")")
+	}
+
+	if s.isPunct("(") {
+		if err := s.next(); err != nil {
+			return nil, err
+		}
+		x, err := parseSum(s)
+		if err != nil {
+			return nil, err
+		}
+		return x, s.expect(")")
+	}
+
+	return nil, fmt.Errorf("unexpected %q in expression", s.tok.text)
+}
+
+func evalExpr(e expr, get func(Ref) (Value, error), funcs map[string]Func) (Value, error) {
+	switch e := e.(type) {
+	case intLit:
+		return e.value, nil
+	case strLit:
+		return e.value, nil
+	case refExpr:
+		return get(e.ref)
+	case unaryExpr:
+		x, err := evalExpr(e.x, get, funcs)
+		if err != nil {
+			return nil, err
+		}
+		switch n := x.(type) {
+		case int:
+			return -n, nil
+		case float64:
+			return -n, nil
+		}
+		return nil, fmt.Errorf("cannot negate %v", x)
+	case binaryExpr:
+		x, err := evalExpr(e.x, get, funcs)
+		if err != nil {
+			return nil, err
+		}
+		y, err := evalExpr(e.y, get, funcs)
+		if err != nil {
+			return nil, err
+		}
+		return binaryOp(e.op, x, y)
+	case callExpr:
+		f, ok := funcs[e.name]
+		if !ok {
+			return nil, fmt.Errorf("unknown function: %s", e.name)
+		}
+		args := make([]Value, 0, len(e.args))
+		for _, a := range e.args {
+			v, err := evalExpr(a, get, funcs)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+		}
+		return f(args)
+	}
+
+	return nil, fmt.Errorf("unknown expression: %v", e)
+}
+
+func binaryOp(op rune, x, y Value) (Value, error) {
+	if a, ok := x.(string); ok {
+		if b, ok := y.(string); ok && op == '+' {
+			return a + b, nil
+		}
+	}
+
+	a, ok1 := x.(int)
+	b, ok2 := y.(int)
+	if !ok1 || !ok2 {
+		return floatOp(op, x, y)
+	}
+
+	switch op {
+	case '+':
+		return a + b, nil
+	case '-':
+		return a - b, nil
+	case '*':
+		return a * b, nil
+	case '/', '%':
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if op == '/' {
+			return a / b, nil
+		}
+		return a % b, nil
+	}
+
+	return nil, fmt.Errorf("unknown operator: %c", op)
+}
+
+// floatOp does the arithmetic of an int and a float64 or two float64s.
+func floatOp(op rune, x, y Value) (Value, error) {
+	a, ok1 := toFloat(x)
+	b, ok2 := toFloat(y)
+	if !ok1 || !ok2 || op == '%' {
+		return nil, fmt.Errorf("invalid operands for %c: %v, %v", op, x, y)
+	}
+
+	switch op {
+	case '+':
+		return a + b, nil
+	case '-':
+		return a - b, nil
+	case '*':
+		return a * b, nil
+	case '/':
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return a / b, nil
+	}
+
+	return nil, fmt.Errorf("unknown operator: %c", op)
+}
+
+func toFloat(v Value) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+var builtins = map[string]Func{
+	"int": func(args []Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("int: expected 1 argument, got %d", len(args))
+		}
+		switch v := args[0].(type) {
+		case int:
+			return v, nil
+		case float64:
+			return int(v), nil
+		case string:
+			return strconv.Atoi(v)
+		}
+		return nil, fmt.Errorf("int: cannot convert %v", args[0])
+	},
+	"float": func(args []Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("float: expected 1 argument, got %d", len(args))
+		}
+		switch v := args[0].(type) {
+		case int:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+		return nil, fmt.Errorf("float: cannot convert %v", args[0])
+	},
+	"str": func(args []Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("str: expected 1 argument, got %d", len(args))
+		}
+		return fmt.Sprint(args[0]), nil
+	},
+}
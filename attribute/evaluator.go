@@ -0,0 +1,431 @@
+package attribute
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AlexisOMG/compilers-lab7-2/common"
+	"github.com/AlexisOMG/compilers-lab7-2/lexer"
+	"github.com/AlexisOMG/compilers-lab7-2/parser"
+)
+
+// Terminals have two attributes: the text of their token and its parsed
+// value, for tokens that have one like numbers.
+const (
+	TextAttr  = "text"
+	ValueAttr = "value"
+)
+
+type production struct {
+	common.Production
+	symbols   []common.Expr
+	equations map[Ref]Equation
+}
+
+func (p *production) ToString() string {
+	var sb strings.Builder
+	sb.WriteString(p.Lhs.Value)
+	sb.WriteString(" ->")
+	for _, e := range p.Rhs {
+		sb.WriteString(" ")
+		if e.Kind == common.Term {
+			sb.WriteString(lexer.QuoteTerm(e.Value))
+		} else {
+			sb.WriteString(e.Value)
+		}
+	}
+	return sb.String()
+}
+
+func (p *production) symbol(i int) common.Expr {
+	if i == 0 {
+		return p.Lhs
+	}
+	return p.symbols[i-1]
+}
+
+type Evaluator struct {
+	Funcs map[string]Func
+
+	attrs map[common.Expr]map[string]Kind
+	prods map[string]*production
+}
+
+func prodKey(lhs common.Expr, rhs []common.Expr) string {
+	var sb strings.Builder
+	sb.WriteString(lhs.Value)
+	for _, e := range rhs {
+		sb.WriteString(" " + e.Kind + ":" + e.Value)
+	}
+	return sb.String()
+}
+
+func NewEvaluator(attrs map[common.Expr]string, prods []common.Production) (*Evaluator, error) {
+	ev := &Evaluator{
+		Funcs: make(map[string]Func, len(builtins)),
+		attrs: make(map[common.Expr]map[string]Kind, len(attrs)),
+		prods: make(map[string]*production, len(prods)),
+	}
+	for name, f := range builtins {
+		ev.Funcs[name] = f
+	}
+
+	for nterm, src := range attrs {
+		decls, err := ParseDecls(src)
+		if err != nil {
+			return nil, fmt.Errorf("attributes of %s: %v", nterm.Value, err)
+		}
+		ev.attrs[nterm] = make(map[string]Kind, len(decls))
+		for _, d := range decls {
+			if _, ok := ev.attrs[nterm][d.Name]; ok {
+				return nil, fmt.Errorf("attributes of %s: %s is declared twice", nterm.Value, d.Name)
+			}
+			ev.attrs[nterm][d.Name] = d.Kind
+		}
+	}
+
+	for _, p := range prods {
+		prod := &production{
+			Production: p,
+			equations:  make(map[Ref]Equation),
+		}
+		for _, e := range p.Rhs {
+			if e != common.Epsilon {
+				prod.symbols = append(prod.symbols, e)
+			}
+		}
+
+		eqs, err := ParseAction(p.Action)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", prod.ToString(), err)
+		}
+		for _, eq := range eqs {
+			if _, ok := prod.equations[eq.Target]; ok {
+				return nil, fmt.Errorf("%s: %s is defined twice", prod.ToString(), eq.Target.ToString())
+			}
+			prod.equations[eq.Target] = eq
+		}
+
+		if err := ev.check(prod); err != nil {
+			return nil, err
+		}
+		ev.prods[prodKey(p.Lhs, p.Rhs)] = prod
+	}
+
+	if err := ev.checkCycles(); err != nil {
+		return nil, err
+	}
+
+	return ev, nil
+}
+
+func (ev *Evaluator) kindOf(sym common.Expr, name string) (Kind, bool) {
+	if sym.Kind == common.Term {
+		return Synthesized, name == TextAttr || name == ValueAttr
+	}
+	k, ok := ev.attrs[sym][name]
+	return k, ok
+}
+
+func (ev *Evaluator) checkRef(p *production, ref Ref) error {
+	if ref.Index < 0 || ref.Index > len(p.symbols) {
+		return fmt.Errorf("%s: %s is out of range", p.ToString(), ref.ToString())
+	}
+	if _, ok := ev.kindOf(p.symbol(ref.Index), ref.Name); !ok {
+		return fmt.Errorf("%s: %s has no attribute %s", p.ToString(), p.symbol(ref.Index).Value, ref.Name)
+	}
+	return nil
+}
+
+// check verifies that the production defines exactly the synthesized
+// attributes of its left-hand side and the inherited attributes of its
+// right-hand side nonterminals.
+func (ev *Evaluator) check(p *production) error {
+	for target, eq := range p.equations {
+		if err := ev.checkRef(p, target); err != nil {
+			return err
+		}
+		kind, _ := ev.kindOf(p.symbol(target.Index), target.Name)
+		if p.symbol(target.Index).Kind == common.Term ||
+			target.Index == 0 && kind != Synthesized ||
+			target.Index != 0 && kind != Inherited {
+			return fmt.Errorf("%s: %s cannot be defined here", p.ToString(), target.ToString())
+		}
+		for _, ref := range eq.Value.refs(nil) {
+			if err := ev.checkRef(p, ref); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := 0; i <= len(p.symbols); i++ {
+		sym := p.symbol(i)
+		if sym.Kind != common.NTerm {
+			continue
+		}
+		for name, kind := range ev.attrs[sym] {
+			required := i == 0 && kind == Synthesized || i != 0 && kind == Inherited
+			if _, ok := p.equations[Ref{Index: i, Name: name}]; required && !ok {
+				return fmt.Errorf("%s: no equation for %s", p.ToString(), Ref{Index: i, Name: name}.ToString())
+			}
+		}
+	}
+
+	return nil
+}
+
+type ioEdge struct {
+	inh, syn string
+}
+
+func (ev *Evaluator) depGraph(p *production, io map[common.Expr]map[ioEdge]struct{}) map[Ref][]Ref {
+	g := make(map[Ref][]Ref)
+	for target, eq := range p.equations {
+		for _, ref := range eq.Value.refs(nil) {
+			g[ref] = append(g[ref], target)
+		}
+	}
+	for i, sym := range p.symbols {
+		for e := range io[sym] {
+			from := Ref{Index: i + 1, Name: e.inh}
+			g[from] = append(g[from], Ref{Index: i + 1, Name: e.syn})
+		}
+	}
+	return g
+}
+
+func findCycle(g map[Ref][]Ref) []Ref {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[Ref]int, len(g))
+	var path []Ref
+
+	var visit func(r Ref) []Ref
+	visit = func(r Ref) []Ref {
+		state[r] = visiting
+		path = append(path, r)
+		for _, next := range g[r] {
+			switch state[next] {
+			case visiting:
+				for i := range path {
+					if path[i] == next {
+						return append(append([]Ref{}, path[i:]...), next)
+					}
+				}
+			case 0:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[r] = done
+		return nil
+	}
+
+	for r := range g {
+		if state[r] == 0 {
+			if cycle := visit(r); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+func reachable(g map[Ref][]Ref, from, to Ref) bool {
+	seen := map[Ref]struct{}{from: {}}
+	queue := []Ref{from}
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		if r == to {
+			return true
+		}
+		for _, next := range g[r] {
+			if _, ok := seen[next]; !ok {
+				seen[next] = struct{}{}
+				queue = append(queue, next)
+			}
+		}
+	}
+	return false
+}
+
+// checkCycles runs the strong non-circularity test: it approximates for
+// every nonterminal which inherited attributes its synthesized attributes
+// may depend on and looks for a cycle in every production's graph.
+func (ev *Evaluator) checkCycles() error {
+	io := make(map[common.Expr]map[ioEdge]struct{}, len(ev.attrs))
+	for nterm := range ev.attrs {
+		io[nterm] = make(map[ioEdge]struct{})
+	}
+
+	changed := true
+	for changed {
+		changed = false
+		for _, p := range ev.prods {
+			g := ev.depGraph(p, io)
+			if cycle := findCycle(g); cycle != nil {
+				names := make([]string, 0, len(cycle))
+				for _, r := range cycle {
+					names = append(names, r.ToString())
+				}
+				return fmt.Errorf("%s: attribute dependency cycle: %s", p.ToString(), strings.Join(names, " -> "))
+			}
+
+			for inh, ik := range ev.attrs[p.Lhs] {
+				for syn, sk := range ev.attrs[p.Lhs] {
+					if ik != Inherited || sk != Synthesized {
+						continue
+					}
+					e := ioEdge{inh: inh, syn: syn}
+					if _, ok := io[p.Lhs][e]; ok {
+						continue
+					}
+					if reachable(g, Ref{Name: inh}, Ref{Name: syn}) {
+						io[p.Lhs][e] = struct{}{}
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+type instance struct {
+	node *parser.Node
+	name string
+}
+
+type evaluation struct {
+	ev      *Evaluator
+	parents map[*parser.Node]*parser.Node
+	indexes map[*parser.Node]int
+	values  map[instance]Value
+	active  map[instance]struct{}
+	rootInh map[string]Value
+}
+
+func (e *evaluation) link(node *parser.Node) {
+	for i, child := range node.Children {
+		e.parents[child] = node
+		e.indexes[child] = i + 1
+		e.link(child)
+	}
+}
+
+func (e *evaluation) productionOf(node *parser.Node) (*production, error) {
+	p, ok := e.ev.prods[prodKey(node.Expr, node.Rule)]
+	if !ok {
+		return nil, fmt.Errorf("no semantic rules for %s", node.Expr.Value)
+	}
+	return p, nil
+}
+
+func (e *evaluation) get(inst instance) (Value, error) {
+	if v, ok := e.values[inst]; ok {
+		return v, nil
+	}
+	if inst.node.Expr.Kind == common.Term {
+		switch inst.name {
+		case TextAttr:
+			return inst.node.Value, nil
+		case ValueAttr:
+			return literalValue(inst.node)
+		}
+		return nil, fmt.Errorf("terminal %s has no attribute %s", inst.node.Expr.Value, inst.name)
+	}
+	if _, ok := e.active[inst]; ok {
+		return nil, fmt.Errorf("attribute dependency cycle at %s.%s", inst.node.Expr.Value, inst.name)
+	}
+
+	kind, ok := e.ev.attrs[inst.node.Expr][inst.name]
+	if !ok {
+		return nil, fmt.Errorf("%s has no attribute %s", inst.node.Expr.Value, inst.name)
+	}
+
+	owner := inst.node
+	target := Ref{Name: inst.name}
+	if kind == Inherited {
+		parent, ok := e.parents[inst.node]
+		if !ok {
+			v, ok := e.rootInh[inst.name]
+			if !ok {
+				return nil, fmt.Errorf("no value for inherited attribute %s.%s", inst.node.Expr.Value, inst.name)
+			}
+			return v, nil
+		}
+		owner = parent
+		target.Index = e.indexes[inst.node]
+	}
+
+	p, err := e.productionOf(owner)
+	if err != nil {
+		return nil, err
+	}
+	eq, ok := p.equations[target]
+	if !ok {
+		return nil, fmt.Errorf("%s: no equation for %s", p.ToString(), target.ToString())
+	}
+
+	e.active[inst] = struct{}{}
+	v, err := evalExpr(eq.Value, func(ref Ref) (Value, error) {
+		node := owner
+		if ref.Index > 0 {
+			node = owner.Children[ref.Index-1]
+		}
+		return e.get(instance{node: node, name: ref.Name})
+	}, e.ev.Funcs)
+	delete(e.active, inst)
+	if err != nil {
+		return nil, err
+	}
+
+	e.values[inst] = v
+	return v, nil
+}
+
+// Evaluate computes the synthesized attributes of root. Inherited
+// attributes of root must be supplied by the caller.
+func (ev *Evaluator) Evaluate(root *parser.Node, inh map[string]Value) (map[string]Value, error) {
+	e := &evaluation{
+		ev:      ev,
+		parents: make(map[*parser.Node]*parser.Node),
+		indexes: make(map[*parser.Node]int),
+		values:  make(map[instance]Value),
+		active:  make(map[instance]struct{}),
+		rootInh: inh,
+	}
+	e.link(root)
+
+	res := make(map[string]Value)
+	for name, kind := range ev.attrs[root.Expr] {
+		if kind != Synthesized {
+			continue
+		}
+		v, err := e.get(instance{node: root, name: name})
+		if err != nil {
+			return nil, err
+		}
+		res[name] = v
+	}
+
+	return res, nil
+}
+
+// literalValue converts the parsed value of a token to the values of
+// attributes: integers become int.
+func literalValue(node *parser.Node) (Value, error) {
+	switch v := node.Literal.(type) {
+	case int64:
+		return int(v), nil
+	case float64:
+		return v, nil
+	}
+	return nil, fmt.Errorf("terminal %s has no value", node.Expr.Value)
+}
@@ -0,0 +1,109 @@
+package attribute
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AlexisOMG/compilers-lab7-2/common"
+)
+
+func nterm(name string) common.Expr {
+	return common.Expr{Kind: common.NTerm, Value: name}
+}
+
+func term(name string) common.Expr {
+	return common.Expr{Kind: common.Term, Value: name}
+}
+
+func TestNewEvaluatorCycles(t *testing.T) {
+	s, e := nterm("S"), nterm("E")
+	tests := []struct {
+		name  string
+		attrs map[common.Expr]string
+		prods []common.Production
+		cycle bool
+	}{
+		{
+			name:  "acyclic",
+			attrs: map[common.Expr]string{e: "syn a, b"},
+			prods: []common.Production{
+				{Lhs: e, Rhs: []common.Expr{term("x")}, Action: "$0.a = $1.value; $0.b = $0.a"},
+			},
+		},
+		{
+			name:  "within a production",
+			attrs: map[common.Expr]string{e: "syn a, b"},
+			prods: []common.Production{
+				{Lhs: e, Rhs: []common.Expr{term("x")}, Action: "$0.a = $0.b; $0.b = $0.a"},
+			},
+			cycle: true,
+		},
+		{
+			name: "through a child",
+			attrs: map[common.Expr]string{
+				s: "syn v",
+				e: "inh i; syn s",
+			},
+			prods: []common.Production{
+				{Lhs: s, Rhs: []common.Expr{e}, Action: "$1.i = $1.s; $0.v = $1.s"},
+				{Lhs: e, Rhs: []common.Expr{term("x")}, Action: "$0.s = $0.i"},
+			},
+			cycle: true,
+		},
+		{
+			name: "inherited from the parent",
+			attrs: map[common.Expr]string{
+				s: "syn v",
+				e: "inh i; syn s",
+			},
+			prods: []common.Production{
+				{Lhs: s, Rhs: []common.Expr{e}, Action: "$1.i = 1; $0.v = $1.s"},
+				{Lhs: e, Rhs: []common.Expr{term("x")}, Action: "$0.s = $0.i"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewEvaluator(test.attrs, test.prods)
+			switch {
+			case test.cycle && (err == nil || !strings.Contains(err.Error(), "attribute dependency cycle")):
+				t.Errorf("NewEvaluator error = %v, want a dependency cycle", err)
+			case !test.cycle && err != nil:
+				t.Errorf("NewEvaluator: %v", err)
+			}
+		})
+	}
+}
+
+func TestEvalExpr(t *testing.T) {
+	tests := []struct {
+		action string
+		value  Value
+		want   Value
+	}{
+		{action: "$0.v = -$1.value", value: 2, want: -2},
+		{action: "$0.v = -$1.value", value: 2.5, want: -2.5},
+		{action: "$0.v = $1.value * 2 + 1", value: 1.5, want: 4.0},
+		{action: "$0.v = int($1.value)", value: 2.5, want: 2},
+	}
+
+	for _, test := range tests {
+		eqs, err := ParseAction(test.action)
+		if err != nil {
+			t.Errorf("%s: %v", test.action, err)
+			continue
+		}
+		get := func(Ref) (Value, error) {
+			return test.value, nil
+		}
+		got, err := evalExpr(eqs[0].Value, get, builtins)
+		if err != nil {
+			t.Errorf("%s with %v: %v", test.action, test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s with %v = %#v, want %#v", test.action, test.value, got, test.want)
+		}
+	}
+}
@@ -4,13 +4,13 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strconv"
 
+	"github.com/AlexisOMG/compilers-lab7-2/attribute"
 	"github.com/AlexisOMG/compilers-lab7-2/lexer"
 	"github.com/AlexisOMG/compilers-lab7-2/parser"
 )
 
-func ComputeE(root *parser.Node) (int, error) {
+func ComputeE(root *parser.Node) (float64, error) {
 	a, err := computeT(root.Children[0])
 	if err != nil {
 		return -1, err
@@ -24,7 +24,7 @@ func ComputeE(root *parser.Node) (int, error) {
 	return a + b, nil
 }
 
-func computeEt(root *parser.Node) (int, error) {
+func computeEt(root *parser.Node) (float64, error) {
 	if len(root.Children) == 0 {
 		return 0, nil
 	}
@@ -42,7 +42,7 @@ func computeEt(root *parser.Node) (int, error) {
 	return a + b, nil
 }
 
-func computeT(root *parser.Node) (int, error) {
+func computeT(root *parser.Node) (float64, error) {
 	if len(root.Children) == 0 {
 		return 1, nil
 	}
@@ -60,7 +60,7 @@ func computeT(root *parser.Node) (int, error) {
 	return a * b, nil
 }
 
-func computeTt(root *parser.Node) (int, error) {
+func computeTt(root *parser.Node) (float64, error) {
 	if len(root.Children) == 0 {
 		return 1, nil
 	}
@@ -78,11 +78,22 @@ func computeTt(root *parser.Node) (int, error) {
 	return a * b, nil
 }
 
-func computeF(root *parser.Node) (int, error) {
-	if len(root.Children) == 1 {
-		return strconv.Atoi(root.Children[0].Value)
-	}
-	return ComputeE(root.Children[1])
+// computeF tells the alternatives of F by their labels, or by the number of
+// children when the grammar does not label them.
+func computeF(root *parser.Node) (float64, error) {
+	switch {
+	case root.Label == "num" || root.Label == "" && len(root.Children) == 1:
+		switch v := root.Children[0].Literal.(type) {
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+		return 0, fmt.Errorf("number %q has no value", root.Children[0].Value)
+	case root.Label == "paren" || root.Label == "":
+		return ComputeE(root.Children[1])
+	}
+	return 0, fmt.Errorf("unexpected alternative of F: %q", root.Label)
 }
 
 func main() {
@@ -90,22 +101,52 @@ func main() {
 		log.Fatal("Wrong usage")
 	}
 	pathToFile := os.Args[1]
+	entry := ""
+	if len(os.Args) > 2 {
+		entry = os.Args[2]
+	}
+
+	var calcLex lexer.Lexer
+	if pathToFile == "-" {
+		calcLex = lexer.NewReaderLexer(os.Stdin, "<stdin>", true)
+	} else {
+		fileLex, err := lexer.NewLexer(pathToFile, true)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer fileLex.Close()
+		calcLex = fileLex
+	}
 
-	calcLex, err := lexer.NewLexer(pathToFile, true)
+	calcRoot, err := parser.Parse(calcLex, "calctable.json", entry)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	calcRoot, err := parser.Parse(calcLex, "calctable.json")
+	calcRoot.Print(1)
+
+	info, err := parser.LoadTableInfo("calctable.json")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	calcRoot.Print(1)
+	if len(info.Attributes) == 0 {
+		res, err := ComputeE(calcRoot)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("RESULT: ", res)
+		return
+	}
+
+	ev, err := attribute.NewEvaluator(info.AttributeMap(), info.Productions)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	res, err := ComputeE(calcRoot)
+	attrs, err := ev.Evaluate(calcRoot, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Println("RESULT: ", res)
+	fmt.Println("RESULT: ", attrs["val"])
 }
@@ -152,6 +152,7 @@ func Follow(rls Rules, axiom Expr, first map[Expr]map[Expr]struct{}) map[Expr]ma
 							allEps := true
 							for k := j + 1; k < len(exprs); k++ {
 								if exprs[k].Kind == Term {
+									allEps = false
 									break
 								}
 								if _, ok := first[exprs[k]][Epsilon]; !ok {
@@ -0,0 +1,41 @@
+package common
+
+import "testing"
+
+func TestFollow(t *testing.T) {
+	s := Expr{Kind: NTerm, Value: "S"}
+	a := Expr{Kind: NTerm, Value: "A"}
+	b := Expr{Kind: NTerm, Value: "B"}
+	x := Expr{Kind: Term, Value: "x"}
+	y := Expr{Kind: Term, Value: "y"}
+
+	// S -> A x | B A y, A -> y, B -> x | eps
+	rls := Rules{
+		s: {{a, x}, {b, a, y}},
+		a: {{y}},
+		b: {{x}, {Epsilon}},
+	}
+	follow := Follow(rls, s, First(rls))
+
+	tests := []struct {
+		nterm Expr
+		want  []Expr
+	}{
+		{nterm: s, want: []Expr{Dollar}},
+		{nterm: a, want: []Expr{x, y}},
+		{nterm: b, want: []Expr{y}},
+	}
+	for _, test := range tests {
+		got := follow[test.nterm]
+		if len(got) != len(test.want) {
+			t.Errorf("FOLLOW(%s) = %v, want %v", test.nterm.Value, got, test.want)
+			continue
+		}
+		for _, e := range test.want {
+			if _, ok := got[e]; !ok {
+				t.Errorf("FOLLOW(%s) = %v, want %v", test.nterm.Value, got, test.want)
+				break
+			}
+		}
+	}
+}
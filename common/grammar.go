@@ -0,0 +1,118 @@
+package common
+
+const (
+	ShapeDrop   = "drop"
+	ShapeInline = "inline"
+	ShapeList   = "list"
+)
+
+type Production struct {
+	Lhs    Expr   `json:"lhs"`
+	Rhs    []Expr `json:"rhs"`
+	Label  string `json:"label,omitempty"`
+	Action string `json:"action,omitempty"`
+}
+
+type Grammar struct {
+	Axioms      []Expr
+	Terminals   []Expr
+	Rules       Rules
+	Productions []Production
+	Attributes  map[Expr]string
+	Shapes      map[Expr]string
+	// Sync lists the terminals the parser may resynchronize at after a
+	// syntax error anywhere; NtermSync adds terminals for single nonterminals.
+	Sync      []Expr
+	NtermSync map[Expr][]Expr
+	// Docs holds the doc comments of declared symbols.
+	Docs map[Expr]string
+}
+
+func NewGrammar() *Grammar {
+	return &Grammar{
+		Rules:      make(Rules),
+		Attributes: make(map[Expr]string),
+		Shapes:     make(map[Expr]string),
+		NtermSync:  make(map[Expr][]Expr),
+		Docs:       make(map[Expr]string),
+	}
+}
+
+// SetRule replaces all alternatives of lhs with prods.
+func (g *Grammar) SetRule(lhs Expr, prods []Production) {
+	kept := g.Productions[:0]
+	for _, p := range g.Productions {
+		if p.Lhs != lhs {
+			kept = append(kept, p)
+		}
+	}
+	g.Productions = kept
+	delete(g.Rules, lhs)
+	g.AddRule(lhs, prods)
+}
+
+// AddRule appends prods to the alternatives of lhs.
+func (g *Grammar) AddRule(lhs Expr, prods []Production) {
+	for _, p := range prods {
+		g.Rules[lhs] = append(g.Rules[lhs], p.Rhs)
+	}
+	g.Productions = append(g.Productions, prods...)
+}
+
+func (g *Grammar) Production(lhs Expr, rhs []Expr) (Production, bool) {
+	for _, p := range g.Productions {
+		if p.Lhs == lhs && SameExprs(p.Rhs, rhs) {
+			return p, true
+		}
+	}
+	return Production{}, false
+}
+
+// AddDoc appends doc to the documentation of e.
+func (g *Grammar) AddDoc(e Expr, doc string) {
+	if doc == "" {
+		return
+	}
+	if prev, ok := g.Docs[e]; ok {
+		doc = prev + "\n" + doc
+	}
+	g.Docs[e] = doc
+}
+
+func (g *Grammar) AddAxiom(axiom Expr) {
+	for _, a := range g.Axioms {
+		if a == axiom {
+			return
+		}
+	}
+	g.Axioms = append(g.Axioms, axiom)
+}
+
+func (g *Grammar) IsAxiom(e Expr) bool {
+	for _, a := range g.Axioms {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Table builds the LL(1) table for parsing from axiom: FOLLOW sets depend on
+// the entry point, so every axiom gets its own table.
+func (g *Grammar) Table(axiom Expr) Table {
+	return BuildTable(g.Rules, axiom, g.Terminals)
+}
+
+func SameExprs(a, b []Expr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
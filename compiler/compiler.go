@@ -1,54 +1,78 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
 
+	"github.com/AlexisOMG/compilers-lab7-2/attribute"
 	"github.com/AlexisOMG/compilers-lab7-2/common"
 	"github.com/AlexisOMG/compilers-lab7-2/lexer"
 	"github.com/AlexisOMG/compilers-lab7-2/parser"
 )
 
 func main() {
-	if len(os.Args) < 2 {
+	strict := flag.Bool("strict", false, "reject repeated $RULE definitions and warn about terminals missing from $TERM")
+	html := flag.String("html", "", "write an HTML reference of the grammar to this file")
+	skipToSpace := flag.Bool("skip-to-space", false, "on a lexical error skip the input up to the next whitespace instead of one character")
+	flag.Parse()
+	if flag.NArg() < 1 {
 		log.Fatal("Wrong usage")
 	}
-	pathToFile := os.Args[1]
+	pathToFile := flag.Arg(0)
 
 	lex, err := lexer.NewLexer(pathToFile, false)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer lex.Close()
+	if *skipToSpace {
+		lex.(lexer.Recovering).SetRecovery(lexer.SkipToSpace)
+	}
 
-	rules := parser.Rules
-	table := common.BuildTable(rules, common.Expr{
-		Kind:  common.NTerm,
-		Value: "S",
-	}, parser.Terminals)
-	err = parser.SaveTableInfo("initial.json", table, common.Expr{
-		Kind:  common.NTerm,
-		Value: "S",
-	})
+	meta := &common.Grammar{
+		Axioms:    []common.Expr{parser.Axiom},
+		Rules:     parser.Rules,
+		Terminals: parser.Terminals,
+	}
+	err = parser.SaveTableInfo("initial.json", meta)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	root, err := parser.Parse(lex, "initial.json")
+	root, err := parser.Parse(lex, "initial.json", "")
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	calcRules, axiom, terminals, err := parser.BuildRules(root)
-	if err != nil {
+	grammar, diags := parser.Diagnose(root, parser.Options{Strict: *strict})
+	for _, d := range diags {
+		fmt.Fprintln(os.Stderr, d.ToString())
+	}
+	if diags.HasErrors() {
+		os.Exit(1)
+	}
+
+	if _, err := attribute.NewEvaluator(grammar.Attributes, grammar.Productions); err != nil {
 		log.Fatal(err)
 	}
 
-	calcTable := common.BuildTable(calcRules, axiom, terminals)
-	err = parser.SaveTableInfo("calctable.json", calcTable, axiom)
+	err = parser.SaveTableInfo("calctable.json", grammar)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if *html != "" {
+		f, err := os.Create(*html)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if err := parser.WriteHTML(f, grammar); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	fmt.Println("Success")
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/AlexisOMG/compilers-lab7-2/lexer"
+	"github.com/AlexisOMG/compilers-lab7-2/parser"
+)
+
+func main() {
+	sortLists := flag.Bool("sort", false, "sort $NTERM and $TERM lists")
+	write := flag.Bool("w", false, "write the result back to the file")
+	check := flag.Bool("check", false, "list files that are not formatted and exit with status 1")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		log.Fatal("Wrong usage")
+	}
+
+	failed := false
+	for _, pathToFile := range flag.Args() {
+		lex, err := lexer.NewLexer(pathToFile, false)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		out, err := parser.Format(lex, parser.FormatOptions{SortLists: *sortLists})
+		lex.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", pathToFile, err)
+		}
+
+		switch {
+		case *check:
+			src, err := ioutil.ReadFile(pathToFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if string(src) != out {
+				fmt.Println(pathToFile)
+				failed = true
+			}
+		case *write:
+			if err := ioutil.WriteFile(pathToFile, []byte(out), 0644); err != nil {
+				log.Fatal(err)
+			}
+		default:
+			fmt.Print(out)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
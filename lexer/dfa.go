@@ -0,0 +1,551 @@
+package lexer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenSpec describes one token of a table-driven lexer. Pattern uses the
+// syntax of the regexp package without anchors at the end or word
+// boundaries.
+type TokenSpec struct {
+	Kind    Kind
+	Pattern string
+	// Skip drops the matched text instead of returning a token, e.g. for
+	// whitespace.
+	Skip bool
+	// Priority decides between patterns matching the same text: the higher
+	// one wins, and on equal priorities the one listed first.
+	Priority int
+	// Mode is the lexer mode the token is recognized in; empty means
+	// InitialMode.
+	Mode string
+	// Push enters a mode after the token, Switch replaces the current mode
+	// and Pop returns to the mode that was current before the last Push.
+	Push   string
+	Switch string
+	Pop    bool
+}
+
+// InitialMode is the mode a lexer starts in.
+const InitialMode = "INITIAL"
+
+func specMode(spec TokenSpec) string {
+	if spec.Mode == "" {
+		return InitialMode
+	}
+	return spec.Mode
+}
+
+// DFA holds a minimal deterministic automaton for every mode of a spec. The
+// scanner takes the longest match and resolves ties of equal length by
+// priority.
+type DFA struct {
+	specs []TokenSpec
+	modes map[string]*automaton
+	// order lists InitialMode and then the other modes as they first appear
+	// in the spec; generated lexers refer to modes by their index in it.
+	order []string
+}
+
+type automaton struct {
+	specs []TokenSpec
+	// bounds are the sorted lower bounds of the rune classes: runes from
+	// bounds[i] up to bounds[i+1] are never told apart by any pattern.
+	bounds []rune
+	ascii  [utf8.RuneSelf]int
+	trans  [][]int
+	accept []int
+	start  int
+}
+
+// CompileDFA builds the NFA of the patterns of every mode, determinizes it
+// by subset construction and minimizes the result.
+func CompileDFA(specs []TokenSpec) (*DFA, error) {
+	d := &DFA{
+		specs: specs,
+		modes: make(map[string]*automaton),
+	}
+
+	order := []string{InitialMode}
+	ids := make(map[string][]int)
+	for i, spec := range specs {
+		mode := specMode(spec)
+		if _, ok := ids[mode]; !ok && mode != InitialMode {
+			order = append(order, mode)
+		}
+		ids[mode] = append(ids[mode], i)
+	}
+	if _, ok := ids[InitialMode]; !ok {
+		return nil, fmt.Errorf("no patterns for the initial mode")
+	}
+
+	for _, spec := range specs {
+		for _, mode := range []string{spec.Push, spec.Switch} {
+			if _, ok := ids[mode]; mode != "" && !ok {
+				return nil, fmt.Errorf("pattern %q enters unknown mode %q", spec.Pattern, mode)
+			}
+		}
+		if spec.Pop && (spec.Push != "" || spec.Switch != "") || spec.Push != "" && spec.Switch != "" {
+			return nil, fmt.Errorf("pattern %q has more than one of push, switch and pop", spec.Pattern)
+		}
+	}
+
+	var msgs []string
+	for _, mode := range order {
+		a, err := compileAutomaton(specs, ids[mode])
+		if err != nil {
+			msgs = append(msgs, err.Error())
+			continue
+		}
+		d.modes[mode] = a
+	}
+	if msgs != nil {
+		return nil, fmt.Errorf("%s", strings.Join(msgs, "\n"))
+	}
+	d.order = order
+	return d, nil
+}
+
+func compileAutomaton(specs []TokenSpec, ids []int) (*automaton, error) {
+	n, start, err := buildNFA(specs, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &automaton{specs: specs}
+	d.bounds = alphabet(n)
+	for r := range d.ascii {
+		d.ascii[r] = d.class(rune(r))
+	}
+
+	shadow := d.determinize(n, start)
+	if a := d.accept[d.start]; a >= 0 {
+		return nil, fmt.Errorf("pattern %q matches the empty string", specs[a].Pattern)
+	}
+	if err := d.checkShadowed(ids, shadow); err != nil {
+		return nil, err
+	}
+	d.minimize()
+	return d, nil
+}
+
+// MustCompileDFA is like CompileDFA but panics on a bad spec. It is meant
+// for the lexers built into the package.
+func MustCompileDFA(specs []TokenSpec) *DFA {
+	d, err := CompileDFA(specs)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// beats reports whether pattern a wins over pattern b on a match of the
+// same length.
+func (d *automaton) beats(a, b int) bool {
+	if d.specs[a].Priority != d.specs[b].Priority {
+		return d.specs[a].Priority > d.specs[b].Priority
+	}
+	return a < b
+}
+
+// checkShadowed reports the patterns that are not accepted in any state:
+// they either match nothing or lose every match to shadow[i].
+func (d *automaton) checkShadowed(ids []int, shadow []int) error {
+	won := make([]bool, len(d.specs))
+	for _, a := range d.accept {
+		if a >= 0 {
+			won[a] = true
+		}
+	}
+
+	var msgs []string
+	for _, i := range ids {
+		spec := d.specs[i]
+		switch {
+		case won[i]:
+		case shadow[i] >= 0:
+			msgs = append(msgs, fmt.Sprintf("pattern %q never wins: every match is taken by %q", spec.Pattern, d.specs[shadow[i]].Pattern))
+		default:
+			msgs = append(msgs, fmt.Sprintf("pattern %q matches nothing", spec.Pattern))
+		}
+	}
+	if msgs != nil {
+		return fmt.Errorf("%s", strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+// alphabet splits the runes into classes at every bound of a range used in
+// the NFA.
+func alphabet(n *nfa) []rune {
+	set := map[rune]bool{0: true}
+	for _, s := range n.states {
+		for i := 0; i < len(s.ranges); i += 2 {
+			set[s.ranges[i]] = true
+			set[s.ranges[i+1]+1] = true
+		}
+	}
+	bounds := make([]rune, 0, len(set))
+	for r := range set {
+		bounds = append(bounds, r)
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	return bounds
+}
+
+func (d *automaton) class(r rune) int {
+	if r >= 0 && r < utf8.RuneSelf && d.ascii[r] != 0 {
+		return d.ascii[r]
+	}
+	return sort.Search(len(d.bounds), func(i int) bool { return d.bounds[i] > r }) - 1
+}
+
+func setKey(set []int) string {
+	sort.Ints(set)
+	var sb strings.Builder
+	for _, s := range set {
+		sb.WriteString(strconv.Itoa(s))
+		sb.WriteByte(',')
+	}
+	return sb.String()
+}
+
+// determinize runs the subset construction. For every pattern it returns a
+// pattern that took one of its matches, or -1.
+func (d *automaton) determinize(n *nfa, start int) []int {
+	shadow := make([]int, len(d.specs))
+	for i := range shadow {
+		shadow[i] = -1
+	}
+
+	var sets [][]int
+	index := make(map[string]int)
+	add := func(set []int) int {
+		key := setKey(set)
+		if i, ok := index[key]; ok {
+			return i
+		}
+		index[key] = len(sets)
+		sets = append(sets, set)
+
+		accept := -1
+		for _, s := range set {
+			if a := n.states[s].accept; a >= 0 && (accept < 0 || d.beats(a, accept)) {
+				accept = a
+			}
+		}
+		for _, s := range set {
+			if a := n.states[s].accept; a >= 0 && a != accept && shadow[a] < 0 {
+				shadow[a] = accept
+			}
+		}
+		d.accept = append(d.accept, accept)
+		return len(sets) - 1
+	}
+
+	d.start = add(n.closure([]int{start}))
+	for i := 0; i < len(sets); i++ {
+		moves := make([][]int, len(d.bounds))
+		for _, s := range sets[i] {
+			st := n.states[s]
+			for j := 0; j < len(st.ranges); j += 2 {
+				for c := d.class(st.ranges[j]); c < len(d.bounds) && d.bounds[c] <= st.ranges[j+1]; c++ {
+					moves[c] = append(moves[c], st.next)
+				}
+			}
+		}
+
+		row := make([]int, len(d.bounds))
+		for c, m := range moves {
+			row[c] = -1
+			if m != nil {
+				row[c] = add(n.closure(m))
+			}
+		}
+		d.trans = append(d.trans, row)
+	}
+	return shadow
+}
+
+// minimize merges equivalent states by refining the partition by accepted
+// pattern until the transitions of every block agree.
+func (d *automaton) minimize() {
+	block := make([]int, len(d.trans))
+	for s := range block {
+		block[s] = d.accept[s]
+	}
+
+	count := -1
+	for {
+		index := make(map[string]int)
+		next := make([]int, len(d.trans))
+		for s, row := range d.trans {
+			var sb strings.Builder
+			sb.WriteString(strconv.Itoa(block[s]))
+			for _, t := range row {
+				sb.WriteByte(',')
+				if t >= 0 {
+					sb.WriteString(strconv.Itoa(block[t]))
+				}
+			}
+			key := sb.String()
+			if _, ok := index[key]; !ok {
+				index[key] = len(index)
+			}
+			next[s] = index[key]
+		}
+		block = next
+		if len(index) == count {
+			break
+		}
+		count = len(index)
+	}
+
+	trans := make([][]int, count)
+	accept := make([]int, count)
+	for s, row := range d.trans {
+		b := block[s]
+		if trans[b] != nil {
+			continue
+		}
+		trans[b] = make([]int, len(row))
+		for c, t := range row {
+			trans[b][c] = -1
+			if t >= 0 {
+				trans[b][c] = block[t]
+			}
+		}
+		accept[b] = d.accept[s]
+	}
+	d.trans, d.accept, d.start = trans, accept, block[d.start]
+}
+
+// States returns the number of states of the automata of all modes.
+func (d *DFA) States() int {
+	n := 0
+	for _, a := range d.modes {
+		n += len(a.trans)
+	}
+	return n
+}
+
+// match returns the length of the longest token at the start of text and
+// the index of its spec, or -1 if no token matches. open reports that the
+// automaton was still running at the end of text, so a longer token may
+// follow with more input.
+func (d *automaton) match(text string) (n, spec int, open bool) {
+	state, spec := d.start, -1
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		state = d.trans[state][d.class(r)]
+		if state < 0 {
+			return n, spec, false
+		}
+		i += size
+		if a := d.accept[state]; a >= 0 {
+			n, spec = i, a
+		}
+	}
+	return n, spec, true
+}
+
+// match runs the automaton of the mode on text.
+func (d *DFA) match(mode, text string) (int, int, bool) {
+	return d.modes[mode].match(text)
+}
+
+type dfaLexer struct {
+	source
+	dfa *DFA
+	// modes is the stack of entered modes; the last one is current.
+	modes []string
+	// leading is the trivia read since the last token.
+	leading string
+	// literal parses the value of a token, if the lexer has typed values.
+	literal func(tok Token) (interface{}, error)
+	err     error
+}
+
+// NewDFALexer scans r with the tables of d.
+func NewDFALexer(d *DFA, r io.Reader, name string) Lexer {
+	return &dfaLexer{
+		source: newReaderSource(name, r),
+		dfa:    d,
+	}
+}
+
+func (l *dfaLexer) Err() error {
+	return l.err
+}
+
+func (l *dfaLexer) HasNext() bool {
+	return l.hasText() || l.readErr != nil || len(l.modes) > 0
+}
+
+// Mode returns the mode the next token is read in.
+func (l *dfaLexer) Mode() string {
+	if len(l.modes) == 0 {
+		return InitialMode
+	}
+	return l.modes[len(l.modes)-1]
+}
+
+// enter applies the mode change of spec. It fails when spec pops the
+// initial mode.
+func (l *dfaLexer) enter(spec TokenSpec) bool {
+	switch {
+	case spec.Push != "":
+		l.modes = append(l.modes, spec.Push)
+	case spec.Switch != "":
+		if len(l.modes) == 0 {
+			l.modes = append(l.modes, spec.Switch)
+		} else {
+			l.modes[len(l.modes)-1] = spec.Switch
+		}
+	case spec.Pop:
+		if len(l.modes) == 0 {
+			return false
+		}
+		l.modes = l.modes[:len(l.modes)-1]
+	}
+	return true
+}
+
+// scan matches the longest token at the start of the text, reading more
+// lines while the token may go on past the end of the buffer.
+func (l *dfaLexer) scan() (int, int) {
+	for {
+		n, id, open := l.dfa.match(l.Mode(), l.text)
+		if !open || !l.more() {
+			return n, id
+		}
+	}
+}
+
+func (l *dfaLexer) NextToken() Token {
+	l.err = nil
+	for l.hasText() {
+		n, id := l.scan()
+		if id < 0 {
+			size, msg := l.badLength()
+			tok := Token{
+				Kind:  Error,
+				Value: l.text[:size],
+				Start: l.curIndex,
+				End:   l.curIndex + size,
+				Pos:   l.pos(),
+				Text:  l.text[:size],
+			}
+			l.err = l.fail(tok.Pos, "%s", msg)
+			l.advance(size)
+			l.attach(&tok)
+			return tok
+		}
+
+		spec := l.dfa.specs[id]
+		tok := Token{
+			Kind:  spec.Kind,
+			Value: l.text[:n],
+			Start: l.curIndex,
+			End:   l.curIndex + n,
+			Pos:   l.pos(),
+			Text:  l.text[:n],
+		}
+		if !l.enter(spec) {
+			tok.Kind = Error
+			l.err = l.fail(tok.Pos, "unbalanced %q", tok.Value)
+		}
+		l.advance(n)
+		if spec.Skip && tok.Kind != Error {
+			if l.trivia {
+				l.leading += tok.Text
+			}
+			continue
+		}
+		if l.literal != nil && tok.Kind != Error {
+			v, err := l.literal(tok)
+			if err != nil {
+				tok.Kind = Error
+				l.err = l.fail(tok.Pos, "%v", err)
+			}
+			tok.Literal = v
+		}
+		l.attach(&tok)
+		return tok
+	}
+
+	if l.readErr != nil {
+		l.err = l.fail(l.pos(), "%v", l.readErr)
+		l.readErr = nil
+		return Token{
+			Kind:  Error,
+			Start: l.curIndex,
+			End:   l.curIndex,
+			Pos:   l.pos(),
+		}
+	}
+	if len(l.modes) > 0 {
+		l.err = l.fail(l.pos(), "unexpected end of input in mode %q", l.Mode())
+		l.modes = nil
+		return Token{
+			Kind:  Error,
+			Start: l.curIndex,
+			End:   l.curIndex,
+			Pos:   l.pos(),
+		}
+	}
+	return Token{
+		Kind:    EOF,
+		Start:   l.curIndex + 1,
+		End:     l.curIndex + 1,
+		Pos:     l.pos(),
+		Leading: l.leading,
+	}
+}
+
+// attach gives tok the pending leading trivia and the skipped text after it
+// on the same line.
+func (l *dfaLexer) attach(tok *Token) {
+	if !l.trivia {
+		return
+	}
+	tok.Leading, l.leading = l.leading, ""
+	if strings.HasSuffix(tok.Text, "\n") {
+		return
+	}
+
+	var pieces []string
+	for l.hasText() {
+		n, id := l.scan()
+		if id < 0 {
+			break
+		}
+		spec := l.dfa.specs[id]
+		if !spec.Skip || spec.Push != "" || spec.Switch != "" || spec.Pop {
+			break
+		}
+		pieces = append(pieces, l.text[:n])
+		l.advance(n)
+		if strings.IndexByte(pieces[len(pieces)-1], '\n') >= 0 {
+			break
+		}
+	}
+	tok.Trailing, l.leading = splitTrivia(pieces)
+}
+
+// CalcSpec lists the tokens of the calculator lexer.
+func CalcSpec() []TokenSpec {
+	return []TokenSpec{
+		{Pattern: `\s+`, Skip: true},
+		{Kind: Plus, Pattern: `\+`},
+		{Kind: Mult, Pattern: `\*`},
+		{Kind: Open, Pattern: `\(`},
+		{Kind: Close, Pattern: `\)`},
+		{Kind: Number, Pattern: numberPattern},
+	}
+}
@@ -0,0 +1,262 @@
+package lexer
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	idKind      = KindByName("id")
+	kwKind      = KindByName("kw")
+	commentKind = KindByName("comment")
+	textKind    = KindByName("text")
+)
+
+func TestCompileDFAErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []TokenSpec
+		want  string
+	}{
+		{
+			name:  "empty match",
+			specs: []TokenSpec{{Kind: idKind, Pattern: `a*`}},
+			want:  `pattern "a*" matches the empty string`,
+		},
+		{
+			name: "shadowed",
+			specs: []TokenSpec{
+				{Kind: idKind, Pattern: `[a-z]+`},
+				{Kind: kwKind, Pattern: `if`},
+			},
+			want: `pattern "if" never wins: every match is taken by "[a-z]+"`,
+		},
+		{
+			name: "unknown mode",
+			specs: []TokenSpec{
+				{Kind: idKind, Pattern: `a`, Push: "nowhere"},
+			},
+			want: `pattern "a" enters unknown mode "nowhere"`,
+		},
+		{
+			name: "no initial mode",
+			specs: []TokenSpec{
+				{Kind: idKind, Pattern: `a`, Mode: "other"},
+			},
+			want: "no patterns for the initial mode",
+		},
+		{
+			name: "push and pop",
+			specs: []TokenSpec{
+				{Kind: idKind, Pattern: `a`, Push: InitialMode, Pop: true},
+			},
+			want: `pattern "a" has more than one of push, switch and pop`,
+		},
+		{
+			name:  "bad syntax",
+			specs: []TokenSpec{{Kind: idKind, Pattern: `(a`}},
+			want:  `pattern "(a"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := CompileDFA(test.specs)
+			if err == nil {
+				t.Fatalf("CompileDFA succeeded, want error %q", test.want)
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("CompileDFA error = %q, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileDFAPriority(t *testing.T) {
+	specs := []TokenSpec{
+		{Pattern: `\s+`, Skip: true},
+		{Kind: idKind, Pattern: `[a-z]+`},
+		{Kind: kwKind, Pattern: `if`, Priority: 1},
+	}
+	d, err := CompileDFA(specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := scanAll(t, NewDFALexer(d, strings.NewReader("if iffy i"), "test"))
+	if want := "kw:if id:iffy id:i"; got != want {
+		t.Errorf("tokens = %q, want %q", got, want)
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	tests := []struct {
+		pattern string
+		states  int
+	}{
+		{pattern: `a|b|c`, states: 2},
+		{pattern: `(a|b)c`, states: 3},
+		{pattern: `ac|bc`, states: 3},
+		{pattern: `(ab)+`, states: 3},
+		{pattern: `a+|aa+`, states: 2},
+	}
+
+	for _, test := range tests {
+		d, err := CompileDFA([]TokenSpec{{Kind: idKind, Pattern: test.pattern}})
+		if err != nil {
+			t.Errorf("%s: %v", test.pattern, err)
+			continue
+		}
+		if got := d.States(); got != test.states {
+			t.Errorf("%s: %d states, want %d", test.pattern, got, test.states)
+		}
+	}
+}
+
+func TestDFALexer(t *testing.T) {
+	comments := []TokenSpec{
+		{Pattern: `\s+`, Skip: true},
+		{Kind: idKind, Pattern: `[a-z]+`},
+		{Kind: commentKind, Pattern: `/\*`, Push: "comment"},
+		{Kind: commentKind, Pattern: `/\*`, Mode: "comment", Push: "comment"},
+		{Kind: commentKind, Pattern: `\*/`, Mode: "comment", Pop: true},
+		{Kind: textKind, Pattern: `[^*/]+|[*/]`, Mode: "comment"},
+	}
+	block := []TokenSpec{
+		{Pattern: `\s+`, Skip: true},
+		{Kind: idKind, Pattern: `[a-z]+`},
+		{Kind: commentKind, Pattern: `/\*[^*]*\*/`},
+	}
+
+	tests := []struct {
+		name  string
+		specs []TokenSpec
+		input string
+		want  string
+	}{
+		{
+			name:  "longest match",
+			specs: CalcSpec(),
+			input: "12+3 * (45)",
+			want:  "n:12 +:+ n:3 *:* (:( n:45 ):)",
+		},
+		{
+			name:  "nested modes",
+			specs: comments,
+			input: "a /* b /* c */ d */ e",
+			want:  "id:a comment:/* text: b  comment:/* text: c  comment:*/ text: d  comment:*/ id:e",
+		},
+		{
+			name:  "end of input in mode",
+			specs: comments,
+			input: "a /* b",
+			want:  "id:a comment:/* text: b Error:",
+		},
+		{
+			name:  "token across lines",
+			specs: block,
+			input: "a /* x\n y */ b",
+			want:  "id:a comment:/* x\n y */ id:b",
+		},
+		{
+			name:  "unexpected character",
+			specs: block,
+			input: "a ! b",
+			want:  "id:a Error:! id:b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, err := CompileDFA(test.specs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := scanAll(t, NewDFALexer(d, strings.NewReader(test.input), "test"))
+			if got != test.want {
+				t.Errorf("tokens = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// regexpLexer is the scanner the lexers used before the DFA: it tries the
+// patterns of the spec one after another and takes the first that matches.
+type regexpLexer struct {
+	text string
+	regs []*regexp.Regexp
+	spec []TokenSpec
+}
+
+func newRegexpLexer(spec []TokenSpec, text string) *regexpLexer {
+	l := &regexpLexer{text: text, spec: spec}
+	for _, s := range spec {
+		l.regs = append(l.regs, regexp.MustCompile("^(?:"+s.Pattern+")"))
+	}
+	return l
+}
+
+func (l *regexpLexer) HasNext() bool {
+	return len(l.text) > 0
+}
+
+func (l *regexpLexer) Err() error {
+	return nil
+}
+
+func (l *regexpLexer) NextToken() Token {
+	for len(l.text) > 0 {
+		matched := false
+		for i, reg := range l.regs {
+			loc := reg.FindStringIndex(l.text)
+			if loc == nil {
+				continue
+			}
+			value := l.text[:loc[1]]
+			l.text = l.text[loc[1]:]
+			if !l.spec[i].Skip {
+				return Token{Kind: l.spec[i].Kind, Value: value}
+			}
+			matched = true
+			break
+		}
+		if !matched {
+			l.text = l.text[1:]
+			return Token{Kind: Error}
+		}
+	}
+	return Token{Kind: EOF}
+}
+
+var benchInput = strings.Repeat("(12 + 345) * 6 + 7890 * (1 + 2)\n", 1000)
+
+func benchmarkLexer(b *testing.B, lex func() Lexer) {
+	b.SetBytes(int64(len(benchInput)))
+	for i := 0; i < b.N; i++ {
+		l := lex()
+		for {
+			tok := l.NextToken()
+			if tok.Kind == EOF {
+				break
+			}
+			if tok.Kind == Error {
+				b.Fatal(l.Err())
+			}
+		}
+	}
+}
+
+// BenchmarkRegexpLexer is the baseline for BenchmarkDFALexer: it tries the
+// regexps of the calculator tokens one by one.
+func BenchmarkRegexpLexer(b *testing.B) {
+	benchmarkLexer(b, func() Lexer {
+		return newRegexpLexer(CalcSpec(), benchInput)
+	})
+}
+
+func BenchmarkDFALexer(b *testing.B) {
+	d := MustCompileDFA(CalcSpec())
+	benchmarkLexer(b, func() Lexer {
+		return NewDFALexer(d, strings.NewReader(benchInput), "bench")
+	})
+}
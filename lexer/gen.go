@@ -0,0 +1,390 @@
+package lexer
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+var goTemplate = template.Must(template.New("lexer").Parse(`// Code generated by lexgen; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AlexisOMG/compilers-lab7-2/lexer"
+)
+
+var {{.Name}}Specs = [...]struct {
+	kind     lexer.Kind
+	skip     bool
+	push     int
+	switchTo int
+	pop      bool
+}{
+{{- range .Specs}}
+	{kind: {{.Kind}}, skip: {{.Skip}}, push: {{.Push}}, switchTo: {{.Switch}}, pop: {{.Pop}}},
+{{- end}}
+}
+
+var {{.Name}}ModeNames = [...]string{ {{- range .Modes}}{{.Name}}, {{end -}} }
+
+var {{.Name}}Start = [...]int{ {{- range .Modes}}{{.Start}}, {{end -}} }
+
+// {{.Name}}Accept gives the spec accepted in every state of every mode, or -1.
+var {{.Name}}Accept = [...][]int{
+{{- range .Modes}}
+	{ {{- range .Accept}}{{.}}, {{end -}} },
+{{- end}}
+}
+
+// {{.Name}}Step moves the automaton of mode on r; -1 means no token goes on
+// with r.
+func {{.Name}}Step(mode, state int, r rune) int {
+	switch mode {
+{{- range $i, $m := .Modes}}
+	case {{$i}}:
+		switch state {
+{{- range $s, $cases := $m.States}}
+		case {{$s}}:
+			switch {
+{{- range $cases}}
+			case {{.Cond}}:
+				return {{.Target}}
+{{- end}}
+			}
+{{- end}}
+		}
+{{- end}}
+	}
+	return -1
+}
+
+type {{.Name}}Lexer struct {
+	r       *bufio.Reader
+	text    string
+	file    string
+	index   int
+	line    int
+	col     int
+	offset  int
+	modes   []int
+	readErr error
+	err     error
+}
+
+// New{{.Export}}Lexer reads the input from r; file is used in positions.
+func New{{.Export}}Lexer(r io.Reader, file string) lexer.Lexer {
+	return &{{.Name}}Lexer{
+		r:     bufio.NewReader(r),
+		file:  file,
+		index: 1,
+		line:  1,
+		col:   1,
+	}
+}
+
+// fill makes sure the text holds a complete line unless the input is over.
+func (l *{{.Name}}Lexer) fill() {
+	if strings.IndexByte(l.text, '\n') < 0 {
+		l.more()
+	}
+}
+
+// more appends the next line of the input to the text. It returns false
+// when the input is already over.
+func (l *{{.Name}}Lexer) more() bool {
+	if l.r == nil {
+		return false
+	}
+	line, err := l.r.ReadString('\n')
+	l.text += line
+	if err != nil {
+		if err != io.EOF {
+			l.readErr = err
+		}
+		l.r = nil
+	}
+	return true
+}
+
+func (l *{{.Name}}Lexer) pos() lexer.Position {
+	return lexer.Position{
+		File:   l.file,
+		Line:   l.line,
+		Column: l.col,
+		Offset: l.offset,
+	}
+}
+
+func (l *{{.Name}}Lexer) advance(n int) {
+	for _, r := range l.text[:n] {
+		if r == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+	}
+	l.index += n
+	l.offset += n
+	l.text = l.text[n:]
+}
+
+// mode returns the index of the current mode; the initial mode is 0.
+func (l *{{.Name}}Lexer) mode() int {
+	if len(l.modes) == 0 {
+		return 0
+	}
+	return l.modes[len(l.modes)-1]
+}
+
+// match returns the length of the longest token at the start of the text
+// and its spec, or -1 if no token matches. It reads more lines while the
+// token may go on past the end of the buffer.
+func (l *{{.Name}}Lexer) match() (int, int) {
+	mode := l.mode()
+	state, n, spec := {{.Name}}Start[mode], 0, -1
+	for i := 0; ; {
+		if i == len(l.text) {
+			if !l.more() {
+				return n, spec
+			}
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(l.text[i:])
+		state = {{.Name}}Step(mode, state, r)
+		if state < 0 {
+			return n, spec
+		}
+		i += size
+		if a := {{.Name}}Accept[mode][state]; a >= 0 {
+			n, spec = i, a
+		}
+	}
+}
+
+func (l *{{.Name}}Lexer) Err() error {
+	return l.err
+}
+
+func (l *{{.Name}}Lexer) HasNext() bool {
+	l.fill()
+	return len(l.text) > 0 || l.readErr != nil || len(l.modes) > 0
+}
+
+func (l *{{.Name}}Lexer) errorToken(msg string) lexer.Token {
+	tok := lexer.Token{
+		Kind:  lexer.Error,
+		Start: l.index,
+		End:   l.index,
+		Pos:   l.pos(),
+	}
+	l.err = &lexer.LexError{Pos: tok.Pos, Msg: msg}
+	return tok
+}
+
+func (l *{{.Name}}Lexer) NextToken() lexer.Token {
+	l.err = nil
+	for l.fill(); len(l.text) > 0; l.fill() {
+		n, id := l.match()
+		if id < 0 {
+			r, size := utf8.DecodeRuneInString(l.text)
+			tok := l.errorToken(fmt.Sprintf("unexpected character %q", r))
+			tok.Value, tok.Text, tok.End = l.text[:size], l.text[:size], l.index+size
+			l.advance(size)
+			return tok
+		}
+
+		spec := {{.Name}}Specs[id]
+		tok := lexer.Token{
+			Kind:  spec.kind,
+			Value: l.text[:n],
+			Start: l.index,
+			End:   l.index + n,
+			Pos:   l.pos(),
+			Text:  l.text[:n],
+		}
+		switch {
+		case spec.push >= 0:
+			l.modes = append(l.modes, spec.push)
+		case spec.switchTo >= 0 && len(l.modes) == 0:
+			l.modes = append(l.modes, spec.switchTo)
+		case spec.switchTo >= 0:
+			l.modes[len(l.modes)-1] = spec.switchTo
+		case spec.pop && len(l.modes) == 0:
+			tok.Kind = lexer.Error
+			l.err = &lexer.LexError{Pos: tok.Pos, Msg: fmt.Sprintf("unbalanced %q", tok.Value)}
+		case spec.pop:
+			l.modes = l.modes[:len(l.modes)-1]
+		}
+		l.advance(n)
+		if !spec.skip || tok.Kind == lexer.Error {
+			return tok
+		}
+	}
+
+	if l.readErr != nil {
+		tok := l.errorToken(l.readErr.Error())
+		l.readErr = nil
+		return tok
+	}
+	if len(l.modes) > 0 {
+		tok := l.errorToken(fmt.Sprintf("unexpected end of input in mode %q", {{.Name}}ModeNames[l.mode()]))
+		l.modes = nil
+		return tok
+	}
+	return lexer.Token{
+		Kind:  lexer.EOF,
+		Start: l.index + 1,
+		End:   l.index + 1,
+		Pos:   l.pos(),
+	}
+}
+`))
+
+type goSpec struct {
+	Kind         string
+	Skip, Pop    bool
+	Push, Switch int
+}
+
+type goCase struct {
+	Cond   string
+	Target int
+}
+
+type goMode struct {
+	Name   string
+	Start  int
+	Accept []int
+	States [][]goCase
+}
+
+// WriteGo writes a Go file of package pkg with a lexer for the spec of d.
+// The lexer is built by New<Name>Lexer and runs the automata as switch
+// statements. It uses this package only for Token and Kind, and importing
+// it compiles no patterns.
+func (d *DFA) WriteGo(w io.Writer, pkg, name string) error {
+	if name == "" || !isIdent(name) {
+		return fmt.Errorf("invalid lexer name %q", name)
+	}
+	data := struct {
+		Package string
+		Name    string
+		Export  string
+		Specs   []goSpec
+		Modes   []goMode
+	}{
+		Package: pkg,
+		Name:    strings.ToLower(name[:1]) + name[1:],
+		Export:  strings.ToUpper(name[:1]) + name[1:],
+	}
+
+	modeIndex := func(mode string) int {
+		if mode == "" {
+			return -1
+		}
+		for i, m := range d.order {
+			if m == mode {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, spec := range d.specs {
+		kind := "0"
+		if !spec.Skip {
+			kind = fmt.Sprintf("lexer.KindByName(%q)", spec.Kind.ToString())
+		}
+		data.Specs = append(data.Specs, goSpec{
+			Kind:   kind,
+			Skip:   spec.Skip,
+			Pop:    spec.Pop,
+			Push:   modeIndex(spec.Push),
+			Switch: modeIndex(spec.Switch),
+		})
+	}
+
+	for _, mode := range d.order {
+		a := d.modes[mode]
+		m := goMode{
+			Name:   strconv.Quote(mode),
+			Start:  a.start,
+			Accept: a.accept,
+		}
+		for _, row := range a.trans {
+			m.States = append(m.States, a.cases(row))
+		}
+		data.Modes = append(data.Modes, m)
+	}
+
+	var buf bytes.Buffer
+	if err := goTemplate.Execute(&buf, data); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// cases turns a row of the transition table into conditions on the rune,
+// one per target state, merging neighbouring classes into ranges.
+func (d *automaton) cases(row []int) []goCase {
+	var res []goCase
+	index := make(map[int]int)
+	for c := 0; c < len(row); c++ {
+		t := row[c]
+		lo := d.bounds[c]
+		for c+1 < len(row) && row[c+1] == t {
+			c++
+		}
+		hi := rune(unicode.MaxRune)
+		if c+1 < len(d.bounds) {
+			hi = d.bounds[c+1] - 1
+		}
+		if t < 0 || lo > unicode.MaxRune {
+			continue
+		}
+		if hi > unicode.MaxRune {
+			hi = unicode.MaxRune
+		}
+
+		cond := "r == " + strconv.QuoteRune(lo)
+		if lo != hi {
+			cond = strconv.QuoteRune(lo) + " <= r && r <= " + strconv.QuoteRune(hi)
+		}
+		if i, ok := index[t]; ok {
+			res[i].Cond += ", " + cond
+			continue
+		}
+		index[t] = len(res)
+		res = append(res, goCase{
+			Cond:   cond,
+			Target: t,
+		})
+	}
+	return res
+}
+
+func isIdent(s string) bool {
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
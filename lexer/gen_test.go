@@ -0,0 +1,119 @@
+package lexer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const genMain = `package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	lex := NewGenLexer(os.Stdin, "test")
+	var res []string
+	for {
+		tok := lex.NextToken()
+		if tok.Kind.ToString() == "EOF" {
+			break
+		}
+		res = append(res, tok.Kind.ToString()+":"+tok.Value)
+	}
+	fmt.Print(strings.Join(res, " "))
+}
+`
+
+// TestWriteGo builds the generated lexer of a spec and checks that it reads
+// the same tokens as the DFA lexer.
+func TestWriteGo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the go command")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		spec  string
+		input string
+	}{
+		{
+			name:  "calculator",
+			spec:  "-  \\s+\n+  \\+\n*  \\*\n(  \\(\n)  \\)\nn  [0-9]+\n",
+			input: "(1 + 23) * 4 ! 5",
+		},
+		{
+			// The first pattern belongs to another mode, so the initial
+			// mode is not the first one in the spec.
+			name:  "modes",
+			spec:  "str @mode=str  [^\"]+\nend @mode=str @pop  \"\n-  \\s+\nid  [a-z]+\nq @push=str  \"\n",
+			input: "ab \"x y\" cd \"z\n w\" e",
+		},
+		{
+			name:  "unclosed mode",
+			spec:  "str @mode=str  [^\"]+\nend @mode=str @pop  \"\n-  \\s+\nid  [a-z]+\nq @push=str  \"\n",
+			input: "ab \"xy",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			specs, err := ReadSpec(strings.NewReader(test.spec))
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := CompileDFA(specs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := scanAll(t, NewDFALexer(d, strings.NewReader(test.input), "test"))
+
+			dir := t.TempDir()
+			var src bytes.Buffer
+			if err := d.WriteGo(&src, "main", "Gen"); err != nil {
+				t.Fatal(err)
+			}
+			files := map[string]string{
+				"lexer.go": src.String(),
+				"main.go":  genMain,
+				"go.mod": "module gentest\n\ngo 1.18\n\n" +
+					"require github.com/AlexisOMG/compilers-lab7-2 v0.0.0\n\n" +
+					"replace github.com/AlexisOMG/compilers-lab7-2 => " + root + "\n",
+			}
+			for name, text := range files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cmd := exec.Command(goCmd, "run", ".")
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off")
+			cmd.Stdin = strings.NewReader(test.input)
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("go run: %v\n%s", err, stderr.String())
+			}
+			if got := string(out); got != want {
+				t.Errorf("generated lexer read %q, want %q", got, want)
+			}
+		})
+	}
+}
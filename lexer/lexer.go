@@ -1,44 +1,107 @@
 package lexer
 
 import (
-	"io/ioutil"
-	"regexp"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/AlexisOMG/compilers-lab7-2/common"
 )
 
-var (
-	axiomKeywordReg = regexp.MustCompile(`^\$AXIOM`)
-	ntermKeywordReg = regexp.MustCompile(`^\$NTERM`)
-	termKeywordReg  = regexp.MustCompile(`^\$TERM`)
-	ruleKeywordReg  = regexp.MustCompile(`^\$RULE`)
-	epsKeywordReg   = regexp.MustCompile(`^\$EPS`)
-	ntermReg        = regexp.MustCompile(`^[A-Z][^ \n]*`)
-	termReg         = regexp.MustCompile(`^"[^ \n]+"`)
-	equalReg        = regexp.MustCompile(`^=`)
-	newLineReg      = regexp.MustCompile(`^\n`)
-	comment         = regexp.MustCompile(`^\*[^\n]*`)
-)
+// grammarSpec lists the tokens of grammar files. Keywords share no text
+// with other tokens, so no priorities are needed.
+var grammarSpec = []TokenSpec{
+	{Kind: AxiomKeyword, Pattern: `\$AXIOM`},
+	{Kind: AxiomKeyword, Pattern: `\$START`},
+	{Kind: NTermKeyword, Pattern: `\$NTERM`},
+	{Kind: TermKeyword, Pattern: `\$TERM`},
+	{Kind: RuleKeyword, Pattern: `\$RULE`},
+	{Kind: EpsKeyword, Pattern: `\$EPS`},
+	{Kind: AttrKeyword, Pattern: `\$ATTR`},
+	{Kind: IncludeKeyword, Pattern: `\$INCLUDE`},
+	{Kind: DropKeyword, Pattern: `\$DROP`},
+	{Kind: InlineKeyword, Pattern: `\$INLINE`},
+	{Kind: ListKeyword, Pattern: `\$LIST`},
+	{Kind: SyncKeyword, Pattern: `\$SYNC`},
+	{Kind: ExtendsKeyword, Pattern: `\$EXTENDS`},
+	{Kind: OverrideKeyword, Pattern: `\$OVERRIDE`},
+	{Kind: Nterm, Pattern: `[\p{L}_][\p{L}\p{M}\p{Nd}_']*(?:\.[\p{L}_][\p{L}\p{M}\p{Nd}_']*)*`},
+	{Kind: Term, Pattern: `"(?:[^"\\\n]|\\.)+"`},
+	{Kind: Equal, Pattern: `=`},
+	{Kind: Action, Pattern: `\{[^}\n]*\}`},
+	{Kind: Less, Pattern: `<`},
+	{Kind: Greater, Pattern: `>`},
+	{Kind: Comma, Pattern: `,`},
+	{Kind: Label, Pattern: `#[A-Za-z_][A-Za-z0-9_]*`},
+	{Kind: NewLine, Pattern: `\n`},
+	{Kind: Comment, Pattern: `\*[^\n]*`},
+	{Pattern: `[ \t]+`, Skip: true},
+}
 
+// The automata of the built-in lexers are compiled on first use, so that
+// generated lexers importing the package do not pay for them.
 var (
-	plusReg  = regexp.MustCompile(`^\+`)
-	mulReg   = regexp.MustCompile(`^\*`)
-	openReg  = regexp.MustCompile(`^\(`)
-	closeReg = regexp.MustCompile(`^\)`)
-	numReg   = regexp.MustCompile(`^\d+`)
-	wsReg    = regexp.MustCompile(`^\s+`)
+	grammarDFA     *DFA
+	grammarDFAOnce sync.Once
+	calcDFA        *DFA
+	calcDFAOnce    sync.Once
 )
 
+func grammarAutomaton() *DFA {
+	grammarDFAOnce.Do(func() {
+		grammarDFA = MustCompileDFA(grammarSpec)
+	})
+	return grammarDFA
+}
+
+func calcAutomaton() *DFA {
+	calcDFAOnce.Do(func() {
+		calcDFA = MustCompileDFA(CalcSpec())
+	})
+	return calcDFA
+}
+
+// leadingWord returns the word at the start of s: everything up to whitespace or
+// one of <>,={}.
+func leadingWord(s string) string {
+	if i := strings.IndexAny(s, " \t\n\f\r<>,={}"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
 const (
 	AxiomKeyword = iota
 	NTermKeyword
 	TermKeyword
 	RuleKeyword
 	EpsKeyword
+	AttrKeyword
+	IncludeKeyword
+	DropKeyword
+	InlineKeyword
+	ListKeyword
+	SyncKeyword
+	ExtendsKeyword
+	OverrideKeyword
 	Term
 	Nterm
 	Equal
+	Action
+	Less
+	Greater
+	Comma
+	Label
 	NewLine
+	Comment
 	EOF
 	Error
 	Plus
@@ -46,13 +109,9 @@ const (
 	Open
 	Close
 	Number
+	Trivia
 )
 
-type regWithKind struct {
-	kind Kind
-	reg  *regexp.Regexp
-}
-
 type Kind int
 
 func (k Kind) ToString() string {
@@ -67,14 +126,42 @@ func (k Kind) ToString() string {
 		return "RuleKeyword"
 	case EpsKeyword:
 		return "EpsKeyword"
+	case AttrKeyword:
+		return "AttrKeyword"
+	case IncludeKeyword:
+		return "IncludeKeyword"
+	case DropKeyword:
+		return "DropKeyword"
+	case InlineKeyword:
+		return "InlineKeyword"
+	case ListKeyword:
+		return "ListKeyword"
+	case SyncKeyword:
+		return "SyncKeyword"
+	case ExtendsKeyword:
+		return "ExtendsKeyword"
+	case OverrideKeyword:
+		return "OverrideKeyword"
 	case Term:
 		return "Term"
 	case Nterm:
 		return "Nterm"
 	case Equal:
 		return "Equal"
+	case Action:
+		return "Action"
+	case Less:
+		return "Less"
+	case Greater:
+		return "Greater"
+	case Comma:
+		return "Comma"
+	case Label:
+		return "Label"
 	case NewLine:
 		return "NewLine"
+	case Comment:
+		return "Comment"
 	case EOF:
 		return "EOF"
 	case Error:
@@ -89,16 +176,99 @@ func (k Kind) ToString() string {
 		return `)`
 	case Number:
 		return `n`
+	case Trivia:
+		return "Trivia"
 	}
 
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	if i := int(k - Trivia - 1); i >= 0 && i < len(kindNames) {
+		return kindNames[i]
+	}
 	return "unknown kind"
 }
 
+var (
+	kindsMu sync.RWMutex
+	// kindNames are the names of the kinds registered after Trivia.
+	kindNames []string
+)
+
+// KindByName returns the kind named name, registering a new one when there
+// is none. Lexers for other languages use it for their own tokens; the
+// parser matches tokens to terminals by this name.
+func KindByName(name string) Kind {
+	for k := Kind(AxiomKeyword); k <= Trivia; k++ {
+		if k.ToString() == name {
+			return k
+		}
+	}
+
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+	for i, n := range kindNames {
+		if n == name {
+			return Trivia + 1 + Kind(i)
+		}
+	}
+	kindNames = append(kindNames, name)
+	return Trivia + Kind(len(kindNames))
+}
+
+// Position locates a token in its source file. Line and Column start at 1,
+// Column counts runes; Offset is the byte offset from the start of the file.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+	Offset int
+}
+
+func (p Position) ToString() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// LexError is a lexical error at a position of the input.
+type LexError struct {
+	Pos Position
+	Msg string
+}
+
+func (e *LexError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos.ToString(), e.Msg)
+}
+
+// Recovery tells how much input an error token swallows.
+type Recovery int
+
+const (
+	// SkipChar drops the first character that no token matches.
+	SkipChar Recovery = iota
+	// SkipToSpace drops everything up to the next whitespace.
+	SkipToSpace
+)
+
 type Token struct {
 	Kind  Kind
 	Value string
 	Start int
 	End   int
+	Pos   Position
+	// Doc is the text of the ** comment lines right above the token.
+	Doc string
+	// Text is the token exactly as it is in the source.
+	Text string
+	// Literal is the parsed value of tokens that have one, like the int64 or
+	// float64 of a calculator number.
+	Literal interface{}
+	// Leading and Trailing are the skipped whitespace and comments before
+	// the token and after it on the same line. They are only filled when
+	// the lexer keeps trivia.
+	Leading  string
+	Trailing string
 }
 
 func (t *Token) ToExpr() common.Expr {
@@ -111,103 +281,358 @@ func (t *Token) ToExpr() common.Expr {
 	}
 }
 
-type calcLexer struct {
+// source is the unread part of the input with the position of its first
+// rune. Input from a reader is buffered a line at a time; a lexer whose
+// token may go on past the end of the buffer asks for more lines.
+type source struct {
+	file     string
 	text     string
-	regs     []regWithKind
+	reader   *bufio.Reader
+	closer   io.Closer
+	readErr  error
+	recovery Recovery
+	errors   []error
+	trivia   bool
 	curIndex int
+	line     int
+	col      int
+	offset   int
 }
 
-func (cl *calcLexer) HasNext() bool {
-	return len(cl.text) > 0
+func newSource(file, text string) source {
+	return source{
+		file:     file,
+		text:     text,
+		curIndex: 1,
+		line:     1,
+		col:      1,
+	}
 }
 
-func (cl *calcLexer) NextToken() Token {
-	if !cl.HasNext() {
-		return Token{
-			Kind:  EOF,
-			Start: cl.curIndex + 1,
-			End:   cl.curIndex + 1,
+func newReaderSource(file string, r io.Reader) source {
+	src := newSource(file, "")
+	src.reader = bufio.NewReader(r)
+	return src
+}
+
+// fill makes sure the text holds a complete line unless the input is over.
+func (s *source) fill() {
+	if strings.IndexByte(s.text, '\n') < 0 {
+		s.more()
+	}
+}
+
+// more appends the next line of the input to the text. It returns false
+// when the input is already over.
+func (s *source) more() bool {
+	if s.reader == nil {
+		return false
+	}
+	line, err := s.reader.ReadString('\n')
+	s.text += line
+	if err != nil {
+		if err != io.EOF {
+			s.readErr = err
 		}
+		s.Close()
+		s.reader = nil
 	}
+	return true
+}
 
-	if loc := wsReg.FindStringIndex(cl.text); loc != nil {
-		cl.text = cl.text[loc[1]:]
-		cl.curIndex += (loc[1] - loc[0])
-		return cl.NextToken()
+// Close releases the file the lexer opened itself. Readers given by the
+// caller are left open.
+func (s *source) Close() error {
+	if s.closer == nil {
+		return nil
 	}
+	err := s.closer.Close()
+	s.closer = nil
+	return err
+}
 
-	for _, r := range cl.regs {
-		if loc := r.reg.FindStringIndex(cl.text); loc != nil {
-			token := Token{
-				Kind:  r.kind,
-				Value: cl.text[loc[0]:loc[1]],
-				Start: cl.curIndex,
-				End:   cl.curIndex + loc[1] - loc[0],
-			}
-			cl.text = cl.text[loc[1]:]
-			cl.curIndex += (loc[1] - loc[0])
-			return token
+func (s *source) hasText() bool {
+	s.fill()
+	return len(s.text) > 0
+}
+
+func (s *source) pos() Position {
+	return Position{
+		File:   s.file,
+		Line:   s.line,
+		Column: s.col,
+		Offset: s.offset,
+	}
+}
+
+// SetRecovery chooses how the lexer goes on after unexpected input.
+func (s *source) SetRecovery(r Recovery) {
+	s.recovery = r
+}
+
+// Errors returns every lexical error met so far.
+func (s *source) Errors() []error {
+	return s.errors
+}
+
+func (s *source) fail(pos Position, format string, args ...interface{}) error {
+	err := &LexError{
+		Pos: pos,
+		Msg: fmt.Sprintf(format, args...),
+	}
+	s.errors = append(s.errors, err)
+	return err
+}
+
+// badLength returns the length of the unexpected text at the start of the
+// input according to the recovery mode, and describes it.
+func (s *source) badLength() (int, string) {
+	r, size := utf8.DecodeRuneInString(s.text)
+	if s.recovery == SkipToSpace {
+		i := strings.IndexFunc(s.text, unicode.IsSpace)
+		if i < 0 {
+			i = len(s.text)
+		}
+		if i > size {
+			return i, fmt.Sprintf("unexpected text %q", s.text[:i])
 		}
 	}
+	return size, fmt.Sprintf("unexpected character %q", r)
+}
 
-	tok := Token{
-		Kind:  Error,
-		Start: cl.curIndex,
-		End:   cl.curIndex,
+// advance skips n bytes of the text keeping the position up to date.
+func (s *source) advance(n int) {
+	for _, r := range s.text[:n] {
+		if r == '\n' {
+			s.line++
+			s.col = 1
+		} else {
+			s.col++
+		}
 	}
+	s.curIndex += n
+	s.offset += n
+	s.text = s.text[n:]
+}
 
-	cl.curIndex += 1
-	cl.text = cl.text[1:]
+// unescape decodes the body of a terminal literal. Supported escapes are
+// \", \\, \n, \t and \uXXXX.
+func unescape(s string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			continue
+		}
 
-	return tok
+		i++
+		switch s[i] {
+		case '"', '\\':
+			sb.WriteByte(s[i])
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("invalid escape sequence: \\%s", s[i:])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape sequence: \\%s", s[i:i+5])
+			}
+			sb.WriteRune(rune(r))
+			i += 4
+		default:
+			return "", fmt.Errorf("unknown escape sequence: \\%c", s[i])
+		}
+	}
+	return sb.String(), nil
+}
 
+// QuoteTerm is the inverse of unescape: it renders a terminal as a literal
+// that the grammar lexer reads back unchanged.
+func QuoteTerm(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case !unicode.IsPrint(r) && r <= 0xFFFF:
+			fmt.Fprintf(&sb, `\u%04x`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
 }
 
+// grammarLexer reads grammar files on demand. Line breaks only matter
+// between the alternatives of a rule, which is decided by looking one token
+// past them, so at most two tokens are read ahead.
 type grammarLexer struct {
-	text     string
-	regs     []regWithKind
-	curIndex int
-	tokens   []Token
-	filtered bool
-	tokIndex int
+	source
+	dir string
+	// comments are only collected when the caller asks for them, so that
+	// memory does not grow with the input.
+	keepComments bool
+	comments     []Token
+	// ahead holds the tokens read but not filtered yet; next is the token
+	// NextToken returns.
+	ahead []Token
+	next  *Token
+	done  bool
+	// State of reading: the kind of the last token, whether it is inside a
+	// rule, the pending doc comment and the trivia of dropped line breaks.
+	lastKind Kind
+	isRule   bool
+	doc      []string
+	docLine  int
+	carry    string
+	// tail is the trivia after the last token.
+	tail string
+	errs map[int]error
+	err  error
 }
 
-func (l *grammarLexer) hasNextSymbol() bool {
-	return len(l.text) > 0
+func (l *grammarLexer) Err() error {
+	return l.err
 }
 
-func (l *grammarLexer) filter() {
-	if l.filtered {
-		return
+func (l *grammarLexer) errorToken(n int, err error) Token {
+	tok := Token{
+		Kind:  Error,
+		Value: l.text[:n],
+		Start: l.curIndex,
+		End:   l.curIndex + n,
+		Pos:   l.pos(),
+		Text:  l.text[:n],
 	}
+	l.errs[tok.Start] = err
+	l.advance(n)
+	return tok
+}
+
+func (l *grammarLexer) hasNextSymbol() bool {
+	return l.hasText()
+}
 
+// readToken reads up to the next token that is not a comment or trivia and
+// puts it into the lookahead.
+func (l *grammarLexer) readToken() {
+	var pieces []string
 	for l.hasNextSymbol() {
-		l.tokens = append(l.tokens, l.nextUnfilteredToken())
+		tok := l.nextUnfilteredToken()
+		if tok.Kind == Trivia {
+			pieces = append(pieces, tok.Text)
+			continue
+		}
+		if tok.Kind == Comment {
+			if l.keepComments {
+				l.comments = append(l.comments, tok)
+			}
+			pieces = append(pieces, tok.Text)
+			if !strings.HasPrefix(tok.Value, "**") {
+				l.doc = nil
+			} else {
+				if tok.Pos.Line != l.docLine+1 {
+					l.doc = nil
+				}
+				l.doc = append(l.doc, strings.TrimPrefix(strings.TrimPrefix(tok.Value, "**"), " "))
+				l.docLine = tok.Pos.Line
+			}
+			continue
+		}
+
+		if tok.Kind != NewLine {
+			if l.doc != nil && tok.Pos.Line == l.docLine+1 {
+				tok.Doc = strings.Join(l.doc, "\n")
+			}
+			l.doc = nil
+		}
+		if tok.Kind == Term && (l.lastKind == IncludeKeyword || l.lastKind == ExtendsKeyword) && !filepath.IsAbs(tok.Value) {
+			tok.Value = filepath.Join(l.dir, tok.Value)
+		}
+		l.lastKind = tok.Kind
+		tok.Leading = l.splitPieces(pieces)
+		l.ahead = append(l.ahead, tok)
+		return
 	}
 
-	filteredTokens := make([]Token, 0, len(l.tokens))
+	l.tail = l.splitPieces(pieces)
+	l.done = true
+	if l.readErr != nil {
+		l.ahead = append(l.ahead, Token{
+			Kind:  Error,
+			Start: l.curIndex,
+			End:   l.curIndex,
+			Pos:   l.pos(),
+		})
+		l.errs[l.curIndex] = l.readErr
+		l.readErr = nil
+	}
+}
 
-	isRule := false
+// peek filters the lookahead down to the next token to return; nil means
+// the input is over.
+func (l *grammarLexer) peek() *Token {
+	for l.next == nil {
+		for len(l.ahead) < 2 && !l.done {
+			l.readToken()
+		}
+		if len(l.ahead) == 0 {
+			return nil
+		}
 
-	for i, t := range l.tokens {
-		switch t.Kind {
-		case RuleKeyword:
-			isRule = true
-		case AxiomKeyword, NTermKeyword, TermKeyword:
-			isRule = false
+		t := l.ahead[0]
+		l.ahead = l.ahead[1:]
+		if t.Kind == RuleKeyword || t.Kind == OverrideKeyword {
+			l.isRule = true
+		} else if isDeclKeyword(t.Kind) {
+			l.isRule = false
 		}
 
-		if t.Kind == NewLine {
-			if isRule && !(i == len(l.tokens)-1 || (i < len(l.tokens)-1 && l.tokens[i+1].Kind == RuleKeyword)) {
-				filteredTokens = append(filteredTokens, t)
+		if t.Kind == NewLine && !(l.isRule && len(l.ahead) > 0 && !isDeclKeyword(l.ahead[0].Kind) && l.ahead[0].Kind != NewLine) {
+			if l.trivia {
+				l.carry += t.Leading + t.Text + t.Trailing
 			}
-		} else {
-			filteredTokens = append(filteredTokens, t)
+			continue
 		}
+		t.Leading = l.carry + t.Leading
+		l.carry = ""
+		l.next = &t
 	}
+	return l.next
+}
 
-	l.tokens = filteredTokens
-	l.filtered = true
+// splitPieces gives the trivia on the line of the last token to it and
+// returns the rest.
+func (l *grammarLexer) splitPieces(pieces []string) string {
+	if !l.trivia {
+		return ""
+	}
+	if n := len(l.ahead); n > 0 && l.ahead[n-1].Kind != NewLine {
+		var leading string
+		l.ahead[n-1].Trailing, leading = splitTrivia(pieces)
+		return leading
+	}
+	return strings.Join(pieces, "")
+}
+
+func isDeclKeyword(k Kind) bool {
+	switch k {
+	case AxiomKeyword, NTermKeyword, TermKeyword, RuleKeyword, AttrKeyword, IncludeKeyword,
+		DropKeyword, InlineKeyword, ListKeyword, SyncKeyword, ExtendsKeyword, OverrideKeyword:
+		return true
+	}
+	return false
 }
 
 func (l *grammarLexer) nextUnfilteredToken() Token {
@@ -216,156 +641,179 @@ func (l *grammarLexer) nextUnfilteredToken() Token {
 			Kind:  EOF,
 			Start: l.curIndex + 1,
 			End:   l.curIndex + 1,
+			Pos:   l.pos(),
 		}
 	}
 
-	if l.text[0] == ' ' || l.text[0] == '\t' {
-		l.text = l.text[1:]
-		l.curIndex += 1
-		return l.nextUnfilteredToken()
-	}
-
-	if loc := comment.FindStringIndex(l.text); loc != nil {
-		l.text = l.text[loc[1]:]
-		l.curIndex += (loc[1] - loc[0])
-		return l.nextUnfilteredToken()
+	// No grammar token goes on past a line break, so the line in the
+	// buffer is enough.
+	dfa := grammarAutomaton()
+	n, spec, _ := dfa.match(InitialMode, l.text)
+	if spec >= 0 && dfa.specs[spec].Skip {
+		if !l.trivia {
+			l.advance(n)
+			return l.nextUnfilteredToken()
+		}
+		tok := Token{
+			Kind:  Trivia,
+			Value: l.text[:n],
+			Start: l.curIndex,
+			End:   l.curIndex + n,
+			Pos:   l.pos(),
+			Text:  l.text[:n],
+		}
+		l.advance(n)
+		return tok
 	}
-
-	for _, r := range l.regs {
-		if loc := r.reg.FindStringIndex(l.text); loc != nil {
-			value := l.text[loc[0]:loc[1]]
-			if r.kind == Term {
-				value = l.text[loc[0]+1 : loc[1]-1]
-			}
-			token := Token{
-				Kind:  r.kind,
-				Value: value,
-				Start: l.curIndex,
-				End:   l.curIndex + loc[1] - loc[0],
+	if spec >= 0 {
+		kind := dfa.specs[spec].Kind
+		value := l.text[:n]
+		switch kind {
+		case Comment:
+			value = strings.TrimRight(value, " \t\r")
+		case Nterm:
+			if word := leadingWord(l.text); len(word) > n {
+				return l.errorToken(len(word), invalidName(word))
 			}
-			if token.Kind == NewLine {
-				token.Value = `\n`
+		case Term:
+			unquoted, err := unescape(value[1 : n-1])
+			if err != nil {
+				return l.errorToken(n, fmt.Errorf("invalid terminal %s: %v", value, err))
 			}
-			l.text = l.text[loc[1]:]
-			l.curIndex += (loc[1] - loc[0])
-			return token
+			value = unquoted
+		case Action:
+			value = value[1 : n-1]
+		case Label:
+			value = value[1:]
+		case NewLine:
+			value = `\n`
 		}
+		token := Token{
+			Kind:  kind,
+			Value: value,
+			Start: l.curIndex,
+			End:   l.curIndex + n,
+			Pos:   l.pos(),
+			Text:  l.text[:n],
+		}
+		l.advance(n)
+		return token
 	}
 
-	tok := Token{
-		Kind:  Error,
-		Start: l.curIndex,
-		End:   l.curIndex,
+	if word := leadingWord(l.text); word != "" {
+		if r, _ := utf8.DecodeRuneInString(word); unicode.IsDigit(r) {
+			return l.errorToken(len(word), invalidName(word))
+		}
 	}
 
-	l.curIndex += 1
-	l.text = l.text[1:]
+	size, msg := l.badLength()
+	return l.errorToken(size, errors.New(msg))
+}
 
-	return tok
+func invalidName(word string) error {
+	return fmt.Errorf("invalid nonterminal name %q: names start with a letter or underscore and contain only letters, digits, underscores and apostrophes", word)
 }
 
 func (l *grammarLexer) HasNext() bool {
-	if !l.filtered {
-		l.filter()
-	}
-
-	return l.tokIndex < len(l.tokens)
+	return l.peek() != nil
 }
 
 func (l *grammarLexer) NextToken() Token {
-	if !l.HasNext() {
+	l.err = nil
+	next := l.peek()
+	if next == nil {
 		return Token{
-			Kind:  EOF,
-			Start: l.curIndex + 1,
-			End:   l.curIndex + 1,
+			Kind:    EOF,
+			Start:   l.curIndex + 1,
+			End:     l.curIndex + 1,
+			Pos:     l.pos(),
+			Leading: l.carry + l.tail,
 		}
 	}
 
-	l.tokIndex += 1
-	return l.tokens[l.tokIndex-1]
+	tok := *next
+	l.next = nil
+	if tok.Kind == Error {
+		l.err = l.fail(tok.Pos, "%v", l.errs[tok.Start])
+		delete(l.errs, tok.Start)
+	}
+	return tok
+}
+
+// KeepComments makes the lexer collect the comments it skips. It has to be
+// called before the first token is read.
+func (l *grammarLexer) KeepComments() {
+	l.keepComments = true
+}
+
+// Comments returns the comments skipped so far, which is all of them once
+// NextToken has returned EOF.
+func (l *grammarLexer) Comments() []Token {
+	return l.comments
+}
+
+// Recovering is implemented by the lexers of this package: they go on after
+// lexical errors and keep all of them.
+type Recovering interface {
+	SetRecovery(r Recovery)
+	Errors() []error
+}
+
+// Commented is implemented by lexers that can keep the comments they skip.
+type Commented interface {
+	KeepComments()
+	Comments() []Token
 }
 
 type Lexer interface {
 	NextToken() Token
 	HasNext() bool
+	// Err describes the lexical error of the last Error token.
+	Err() error
+}
+
+// FileLexer is a Lexer that owns its input and must be closed.
+type FileLexer interface {
+	Lexer
+	io.Closer
 }
 
-func NewLexer(pathToFile string, isCalc bool) (Lexer, error) {
-	data, err := ioutil.ReadFile(pathToFile)
+// NewLexer opens a file and reads it as the lexer goes. The file is closed
+// once the whole input is consumed; callers that may stop earlier close it
+// with Close.
+func NewLexer(pathToFile string, isCalc bool) (FileLexer, error) {
+	f, err := os.Open(pathToFile)
 	if err != nil {
 		return nil, err
 	}
+	src := newReaderSource(pathToFile, f)
+	src.closer = f
+	return newLexer(src, isCalc), nil
+}
 
+// NewReaderLexer reads the input from r without loading it into memory and
+// never closes r. The name is used in positions and to resolve $INCLUDE
+// paths of grammars.
+func NewReaderLexer(r io.Reader, name string, isCalc bool) Lexer {
+	return newLexer(newReaderSource(name, r), isCalc)
+}
+
+func NewStringLexer(text, name string, isCalc bool) Lexer {
+	return newLexer(newSource(name, text), isCalc)
+}
+
+func newLexer(src source, isCalc bool) FileLexer {
 	if isCalc {
-		return &calcLexer{
-			text:     string(data),
-			curIndex: 1,
-			regs: []regWithKind{
-				{
-					reg:  plusReg.Copy(),
-					kind: Plus,
-				},
-				{
-					reg:  mulReg.Copy(),
-					kind: Mult,
-				},
-				{
-					reg:  openReg.Copy(),
-					kind: Open,
-				},
-				{
-					reg:  closeReg.Copy(),
-					kind: Close,
-				},
-				{
-					reg:  numReg.Copy(),
-					kind: Number,
-				},
-			},
-		}, nil
+		return &dfaLexer{
+			source:  src,
+			dfa:     calcAutomaton(),
+			literal: calcLiteral,
+		}
 	}
 
 	return &grammarLexer{
-		text:     string(data),
-		curIndex: 1,
-		filtered: false,
-		regs: []regWithKind{
-			{
-				reg:  axiomKeywordReg.Copy(),
-				kind: AxiomKeyword,
-			},
-			{
-				reg:  ntermKeywordReg.Copy(),
-				kind: NTermKeyword,
-			},
-			{
-				reg:  termKeywordReg.Copy(),
-				kind: TermKeyword,
-			},
-			{
-				reg:  ruleKeywordReg.Copy(),
-				kind: RuleKeyword,
-			},
-			{
-				reg:  epsKeywordReg.Copy(),
-				kind: EpsKeyword,
-			},
-			{
-				reg:  ntermReg.Copy(),
-				kind: Nterm,
-			},
-			{
-				reg:  termReg.Copy(),
-				kind: Term,
-			},
-			{
-				reg:  equalReg.Copy(),
-				kind: Equal,
-			},
-			{
-				reg:  newLineReg.Copy(),
-				kind: NewLine,
-			},
-		},
-	}, nil
+		source: src,
+		dir:    filepath.Dir(src.file),
+		errs:   make(map[int]error),
+	}
 }
@@ -0,0 +1,181 @@
+package lexer
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// scanAll reads every token of lex as kind:value, stopping at EOF.
+func scanAll(t *testing.T, lex Lexer) string {
+	t.Helper()
+	var res []string
+	for i := 0; ; i++ {
+		if i > 1000 {
+			t.Fatal("lexer does not reach EOF")
+		}
+		tok := lex.NextToken()
+		if tok.Kind == EOF {
+			return strings.Join(res, " ")
+		}
+		res = append(res, tok.Kind.ToString()+":"+tok.Value)
+	}
+}
+
+func TestQuoteTermRoundTrip(t *testing.T) {
+	tests := []string{
+		"+",
+		"a b",
+		`"`,
+		`\`,
+		`\n`,
+		"tab\there",
+		"line\nbreak",
+		"\x01",
+		"é∀",
+		`say "hi"\`,
+	}
+
+	for _, s := range tests {
+		quoted := QuoteTerm(s)
+		got, err := unescape(quoted[1 : len(quoted)-1])
+		if err != nil {
+			t.Errorf("unescape(%s): %v", quoted, err)
+			continue
+		}
+		if got != s {
+			t.Errorf("unescape(%s) = %q, want %q", quoted, got, s)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+		err  string
+	}{
+		{body: `a\"b`, want: `a"b`},
+		{body: `\\`, want: `\`},
+		{body: `\n\t`, want: "\n\t"},
+		{body: `é`, want: "é"},
+		{body: `\q`, err: `unknown escape sequence: \q`},
+		{body: `\u12`, err: `invalid escape sequence: \u12`},
+		{body: `\u12zz`, err: `invalid escape sequence: \u12zz`},
+	}
+
+	for _, test := range tests {
+		got, err := unescape(test.body)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("unescape(%s) error = %v, want %q", test.body, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("unescape(%s) = %q, %v, want %q", test.body, got, err, test.want)
+		}
+	}
+}
+
+func TestNontermNames(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "expr E1' выраж_2 lib.List", want: "Nterm:expr Nterm:E1' Nterm:выраж_2 Nterm:lib.List"},
+		{input: "A\"= B", want: "Error:A\" Equal:= Nterm:B"},
+		{input: "1abc", want: "Error:1abc"},
+	}
+
+	for _, test := range tests {
+		got := scanAll(t, NewStringLexer(test.input, "test", false))
+		if got != test.want {
+			t.Errorf("%s: tokens %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+// closeRecorder is a reader that remembers whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestReaderLexer(t *testing.T) {
+	text := "$AXIOM E\n* comment\n$NTERM E\n$TERM \"n\" \"+\"\n$RULE E = \"n\" \"+\" E\n  \"n\"\n"
+	want := scanAll(t, NewStringLexer(text, "grammar.txt", false))
+
+	r := &closeRecorder{Reader: iotest.OneByteReader(strings.NewReader(text))}
+	if got := scanAll(t, NewReaderLexer(r, "grammar.txt", false)); got != want {
+		t.Errorf("reader lexer:\n%s\nwant:\n%s", got, want)
+	}
+	if r.closed {
+		t.Error("reader lexer closed its reader")
+	}
+}
+
+func TestNewLexerClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calc.txt")
+	if err := ioutil.WriteFile(path, []byte("1 + 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lex, err := NewLexer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lex.NextToken()
+	if err := lex.Close(); err != nil {
+		t.Errorf("close before EOF: %v", err)
+	}
+
+	lex, err = NewLexer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanAll(t, lex)
+	if err := lex.Close(); err != nil {
+		t.Errorf("close after EOF: %v", err)
+	}
+}
+
+// lineReader gives one line per Read and counts the lines it gave.
+type lineReader struct {
+	lines  []string
+	served int
+}
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	if r.served == len(r.lines) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.lines[r.served])
+	r.served++
+	return n, nil
+}
+
+func TestGrammarLexerLazy(t *testing.T) {
+	r := &lineReader{lines: []string{"$AXIOM E\n", "$NTERM E\n", "$TERM \"n\"\n"}}
+	for i := 0; i < 100; i++ {
+		r.lines = append(r.lines, "$RULE E = \"n\"\n")
+	}
+
+	lex := NewReaderLexer(r, "grammar.txt", false)
+	for _, want := range []Kind{AxiomKeyword, Nterm, NTermKeyword} {
+		if tok := lex.NextToken(); tok.Kind != want {
+			t.Fatalf("token %s, want %s", tok.Kind.ToString(), want.ToString())
+		}
+	}
+	if r.served > 3 {
+		t.Errorf("lexer read %d lines for tokens of the first 2", r.served)
+	}
+}
@@ -0,0 +1,154 @@
+package lexer
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"unicode"
+)
+
+// nfaState is a state of a Thompson NFA. It either moves on a rune from
+// ranges (pairs of inclusive bounds) to next, or has only empty moves.
+type nfaState struct {
+	ranges []rune
+	next   int
+	eps    []int
+	accept int
+}
+
+type nfa struct {
+	states []nfaState
+}
+
+func (n *nfa) newState() int {
+	n.states = append(n.states, nfaState{next: -1, accept: -1})
+	return len(n.states) - 1
+}
+
+func (n *nfa) addEps(from, to int) {
+	n.states[from].eps = append(n.states[from].eps, to)
+}
+
+func (n *nfa) addRanges(from, to int, ranges []rune) {
+	n.states[from].ranges = ranges
+	n.states[from].next = to
+}
+
+// buildNFA joins the automata of the patterns listed in ids under a common
+// start state. The accepting state of a pattern is marked with its index.
+func buildNFA(specs []TokenSpec, ids []int) (*nfa, int, error) {
+	n := &nfa{}
+	start := n.newState()
+	for _, i := range ids {
+		spec := specs[i]
+		re, err := syntax.Parse(spec.Pattern, syntax.Perl)
+		if err != nil {
+			return nil, 0, fmt.Errorf("pattern %q: %v", spec.Pattern, err)
+		}
+		s, e, err := n.compile(re.Simplify())
+		if err != nil {
+			return nil, 0, fmt.Errorf("pattern %q: %v", spec.Pattern, err)
+		}
+		n.states[e].accept = i
+		n.addEps(start, s)
+	}
+	return n, start, nil
+}
+
+// compile adds the fragment for re and returns its entry and exit states.
+func (n *nfa) compile(re *syntax.Regexp) (int, int, error) {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginText, syntax.OpBeginLine:
+		// Patterns are always matched at the start of the rest of the input,
+		// so a leading ^ changes nothing.
+		s := n.newState()
+		return s, s, nil
+	case syntax.OpNoMatch:
+		return n.newState(), n.newState(), nil
+	case syntax.OpLiteral:
+		s := n.newState()
+		e := s
+		for _, r := range re.Rune {
+			next := n.newState()
+			ranges := []rune{r, r}
+			if re.Flags&syntax.FoldCase != 0 {
+				for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+					ranges = append(ranges, f, f)
+				}
+			}
+			n.addRanges(e, next, ranges)
+			e = next
+		}
+		return s, e, nil
+	case syntax.OpCharClass:
+		s, e := n.newState(), n.newState()
+		n.addRanges(s, e, re.Rune)
+		return s, e, nil
+	case syntax.OpAnyCharNotNL:
+		s, e := n.newState(), n.newState()
+		n.addRanges(s, e, []rune{0, '\n' - 1, '\n' + 1, unicode.MaxRune})
+		return s, e, nil
+	case syntax.OpAnyChar:
+		s, e := n.newState(), n.newState()
+		n.addRanges(s, e, []rune{0, unicode.MaxRune})
+		return s, e, nil
+	case syntax.OpCapture:
+		return n.compile(re.Sub[0])
+	case syntax.OpConcat:
+		s := n.newState()
+		e := s
+		for _, sub := range re.Sub {
+			ss, se, err := n.compile(sub)
+			if err != nil {
+				return 0, 0, err
+			}
+			n.addEps(e, ss)
+			e = se
+		}
+		return s, e, nil
+	case syntax.OpAlternate:
+		s, e := n.newState(), n.newState()
+		for _, sub := range re.Sub {
+			ss, se, err := n.compile(sub)
+			if err != nil {
+				return 0, 0, err
+			}
+			n.addEps(s, ss)
+			n.addEps(se, e)
+		}
+		return s, e, nil
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest:
+		ss, se, err := n.compile(re.Sub[0])
+		if err != nil {
+			return 0, 0, err
+		}
+		s, e := n.newState(), n.newState()
+		n.addEps(s, ss)
+		n.addEps(se, e)
+		if re.Op != syntax.OpPlus {
+			n.addEps(s, e)
+		}
+		if re.Op != syntax.OpQuest {
+			n.addEps(se, ss)
+		}
+		return s, e, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported construct %s", re)
+}
+
+// closure extends set with every state reachable by empty moves.
+func (n *nfa) closure(set []int) []int {
+	seen := make(map[int]bool, len(set))
+	stack := append([]int(nil), set...)
+	var res []int
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		res = append(res, s)
+		stack = append(stack, n.states[s].eps...)
+	}
+	return res
+}
@@ -0,0 +1,59 @@
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// numberPattern matches the number literals of the calculator: decimal
+// integers and fractions with an optional exponent, and integers with a 0x,
+// 0b or 0o prefix. Digits may be separated by single underscores.
+const numberPattern = `0[xX]_?[0-9a-fA-F]+(?:_[0-9a-fA-F]+)*` +
+	`|0[bB]_?[01]+(?:_[01]+)*` +
+	`|0[oO]_?[0-7]+(?:_[0-7]+)*` +
+	`|(?:\d+(?:_\d+)*(?:\.(?:\d+(?:_\d+)*)?)?|\.\d+(?:_\d+)*)(?:[eE][+-]?\d+(?:_\d+)*)?`
+
+// ParseNumber returns the value of a number literal: an int64 for integers
+// and a float64 for literals with a fraction or an exponent. A leading zero
+// does not make a decimal integer octal.
+func ParseNumber(text string) (interface{}, error) {
+	lower := strings.ToLower(text)
+	switch {
+	case strings.HasPrefix(lower, "0x"), strings.HasPrefix(lower, "0b"), strings.HasPrefix(lower, "0o"):
+		return parseInt(text, 0)
+	case strings.ContainsAny(lower, ".e"):
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, numberError(text, err)
+		}
+		return v, nil
+	}
+	if strings.Contains(text, "__") || strings.HasPrefix(text, "_") || strings.HasSuffix(text, "_") {
+		return nil, fmt.Errorf("invalid number %s", text)
+	}
+	return parseInt(strings.ReplaceAll(text, "_", ""), 10)
+}
+
+func parseInt(text string, base int) (interface{}, error) {
+	v, err := strconv.ParseInt(text, base, 64)
+	if err != nil {
+		return nil, numberError(text, err)
+	}
+	return v, nil
+}
+
+func numberError(text string, err error) error {
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		return fmt.Errorf("number %s is out of range", text)
+	}
+	return fmt.Errorf("invalid number %s", text)
+}
+
+// calcLiteral gives number tokens of the calculator their value.
+func calcLiteral(tok Token) (interface{}, error) {
+	if tok.Kind != Number {
+		return nil, nil
+	}
+	return ParseNumber(tok.Value)
+}
@@ -0,0 +1,44 @@
+package lexer
+
+import "testing"
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		text string
+		want interface{}
+		err  string
+	}{
+		{text: "42", want: int64(42)},
+		{text: "017", want: int64(17)},
+		{text: "1_000", want: int64(1000)},
+		{text: "0x1F", want: int64(31)},
+		{text: "0b_1010", want: int64(10)},
+		{text: "0o17", want: int64(15)},
+		{text: "2.5", want: 2.5},
+		{text: ".5", want: 0.5},
+		{text: "1.", want: 1.0},
+		{text: "1e3", want: 1000.0},
+		{text: "1_0.2_5e-1", want: 1.025},
+		{text: "99999999999999999999", err: "number 99999999999999999999 is out of range"},
+		{text: "0xFFFFFFFFFFFFFFFFF", err: "number 0xFFFFFFFFFFFFFFFFF is out of range"},
+		{text: "1e999", err: "number 1e999 is out of range"},
+		{text: "1__0", err: "invalid number 1__0"},
+	}
+
+	for _, test := range tests {
+		got, err := ParseNumber(test.text)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("ParseNumber(%q) error = %v, want %q", test.text, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseNumber(%q): %v", test.text, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseNumber(%q) = %#v, want %#v", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package lexer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadSpec reads a token spec in the format of lexgen. Every line holds the
+// name of a token, its options and then the pattern up to the end of the
+// line:
+//
+//	n  [0-9]+
+//	-  @skip \s+
+//	"  @push=str "
+//
+// The options are @skip, @priority=N, @mode=M, @push=M, @switch=M and @pop.
+// The name - is for skipped text. Empty lines and lines starting with //
+// are ignored.
+func ReadSpec(r io.Reader) ([]TokenSpec, error) {
+	var specs []TokenSpec
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+
+		name, rest := cutWord(text)
+		spec := TokenSpec{Skip: name == "-"}
+		if !spec.Skip {
+			spec.Kind = KindByName(name)
+		}
+		for strings.HasPrefix(rest, "@") {
+			var opt string
+			opt, rest = cutWord(rest)
+			key, value, _ := strings.Cut(opt[1:], "=")
+			switch key {
+			case "skip":
+				spec.Skip = true
+			case "pop":
+				spec.Pop = true
+			case "mode":
+				spec.Mode = value
+			case "push":
+				spec.Push = value
+			case "switch":
+				spec.Switch = value
+			case "priority":
+				p, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, fmt.Errorf("%d: invalid priority %q", line, value)
+				}
+				spec.Priority = p
+			default:
+				return nil, fmt.Errorf("%d: unknown option %s", line, opt)
+			}
+		}
+		if rest == "" {
+			return nil, fmt.Errorf("%d: token %s has no pattern", line, name)
+		}
+		spec.Pattern = rest
+		specs = append(specs, spec)
+	}
+	return specs, scanner.Err()
+}
+
+func cutWord(s string) (string, string) {
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
@@ -0,0 +1,36 @@
+package lexer
+
+import "strings"
+
+// TriviaKeeper is implemented by lexers that can attach the whitespace and
+// comments they skip to the tokens around them.
+type TriviaKeeper interface {
+	KeepTrivia()
+}
+
+// KeepTrivia makes the lexer fill Leading and Trailing of every token. It
+// has to be called before the first token is read.
+func (s *source) KeepTrivia() {
+	s.trivia = true
+}
+
+// splitTrivia divides the trivia after a token into the part that stays on
+// its line and the rest, which leads the next token. A piece of whitespace
+// is cut at its first line break; other pieces are never cut.
+func splitTrivia(pieces []string) (string, string) {
+	var trailing strings.Builder
+	for i, p := range pieces {
+		nl := strings.IndexByte(p, '\n')
+		if nl < 0 {
+			trailing.WriteString(p)
+			continue
+		}
+		rest := strings.Join(pieces[i+1:], "")
+		if strings.TrimSpace(p) == "" {
+			trailing.WriteString(p[:nl])
+			return trailing.String(), p[nl:] + rest
+		}
+		return trailing.String(), p + rest
+	}
+	return trailing.String(), ""
+}
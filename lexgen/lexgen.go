@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/AlexisOMG/compilers-lab7-2/lexer"
+)
+
+func main() {
+	pkg := flag.String("pkg", "main", "package of the generated file")
+	name := flag.String("name", "Gen", "the lexer is built by New<name>Lexer")
+	out := flag.String("o", "", "output file instead of standard output")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		log.Fatal("Wrong usage")
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	specs, err := lexer.ReadSpec(f)
+	if err != nil {
+		log.Fatalf("%s:%v", flag.Arg(0), err)
+	}
+	dfa, err := lexer.CompileDFA(specs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		w, err = os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer w.Close()
+	}
+	if err := dfa.WriteGo(w, *pkg, *name); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,761 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/AlexisOMG/compilers-lab7-2/common"
+	"github.com/AlexisOMG/compilers-lab7-2/lexer"
+)
+
+const maxTemplateDepth = 64
+
+var (
+	metaTable     *parsingTable
+	metaTableOnce sync.Once
+)
+
+func grammarTable() *parsingTable {
+	metaTableOnce.Do(func() {
+		metaTable = &parsingTable{
+			axiom: Axiom,
+			table: common.BuildTable(Rules, Axiom, Terminals),
+		}
+	})
+	return metaTable
+}
+
+func declarations(root *Node) []*Node {
+	var res []*Node
+	for node := root; len(node.Children) != 0; node = node.Children[1] {
+		res = append(res, node.Children[0])
+	}
+	return res
+}
+
+func collectList(decl *Node) []*Node {
+	res := []*Node{decl.Children[1]}
+	for node := decl.Children[2]; len(node.Children) != 0; node = node.Children[1] {
+		res = append(res, node.Children[0])
+	}
+	return res
+}
+
+func termExpr(name string) common.Expr {
+	return common.Expr{
+		Kind:  common.Term,
+		Value: name,
+	}
+}
+
+func ntermExpr(prefix, name string) common.Expr {
+	return common.Expr{
+		Kind:  common.NTerm,
+		Value: prefix + name,
+	}
+}
+
+type template struct {
+	params []string
+	bodies []*Node
+	prefix string
+	pos    lexer.Position
+	// doc is given to every instance of the template.
+	doc string
+}
+
+type scope struct {
+	prefix string
+	params map[string]common.Expr
+}
+
+// Options control how strictly BuildRules treats questionable grammars.
+type Options struct {
+	// Strict rejects repeated $RULE definitions of the same nonterminal
+	// instead of merging their alternatives in order and warns about
+	// terminals missing from $TERM.
+	Strict bool
+}
+
+// ruleDef is where the rule of a nonterminal was last defined and whether
+// that was in a base grammar.
+type ruleDef struct {
+	pos  lexer.Position
+	base bool
+}
+
+type declaration struct {
+	pos  lexer.Position
+	root bool
+}
+
+// site is the outermost template use being instantiated: problems inside
+// template bodies are reported there.
+type site struct {
+	pos  lexer.Position
+	text string
+}
+
+type grammarBuilder struct {
+	opts      Options
+	g         *common.Grammar
+	nterms    map[common.Expr]struct{}
+	terms     map[common.Expr]struct{}
+	termOrder []common.Expr
+	templates map[string]*template
+	tmplShape map[string]string
+	included  map[string]struct{}
+	chain     []string
+	libs      int
+	bases     int
+	depth     int
+	site      site
+	diags     Diagnostics
+	declared  map[common.Expr]declaration
+	declOrder []common.Expr
+	used      map[common.Expr]struct{}
+	shapePos  map[common.Expr]lexer.Position
+	rulePos   map[common.Expr]ruleDef
+}
+
+// Diagnose builds the grammar described by root and reports every problem
+// it finds instead of stopping at the first one.
+func Diagnose(root *Node, opts Options) (*common.Grammar, Diagnostics) {
+	b := &grammarBuilder{
+		opts:      opts,
+		g:         common.NewGrammar(),
+		nterms:    make(map[common.Expr]struct{}),
+		terms:     make(map[common.Expr]struct{}),
+		templates: make(map[string]*template),
+		tmplShape: make(map[string]string),
+		included:  make(map[string]struct{}),
+		declared:  make(map[common.Expr]declaration),
+		used:      make(map[common.Expr]struct{}),
+		shapePos:  make(map[common.Expr]lexer.Position),
+		rulePos:   make(map[common.Expr]ruleDef),
+	}
+
+	// The root file starts the include chain so that a cycle back to it is
+	// reported before the file is read a second time.
+	if root.Pos.File != "" {
+		if abs, err := filepath.Abs(root.Pos.File); err == nil {
+			b.chain = append(b.chain, abs)
+		}
+	}
+	b.module(root, "")
+	if len(b.g.Axioms) == 0 {
+		b.errorf(root.Pos, "axiom is not declared")
+	}
+
+	b.g.Terminals = b.termOrder
+
+	b.checkSymbols()
+	b.checkShapes()
+
+	b.diags.sort()
+	return b.g, b.diags
+}
+
+func BuildRules(root *Node, opts Options) (*common.Grammar, error) {
+	g, diags := Diagnose(root, opts)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return g, nil
+}
+
+func (b *grammarBuilder) report(severity Severity, pos lexer.Position, msg string) {
+	if b.depth > 0 {
+		pos = b.site.pos
+		msg = b.site.text + ": " + msg
+	}
+	b.diags = append(b.diags, Diagnostic{
+		Pos:      pos,
+		Severity: severity,
+		Message:  msg,
+	})
+}
+
+func (b *grammarBuilder) errorf(pos lexer.Position, format string, args ...interface{}) {
+	b.report(SeverityError, pos, fmt.Sprintf(format, args...))
+}
+
+func (b *grammarBuilder) warnf(pos lexer.Position, format string, args ...interface{}) {
+	b.report(SeverityWarning, pos, fmt.Sprintf(format, args...))
+}
+
+// describe gives the last diagnostic the doc comment of the symbol it is
+// about, for editors to show on hover.
+func (b *grammarBuilder) describe(e common.Expr) {
+	b.diags[len(b.diags)-1].Doc = b.g.Docs[e]
+}
+
+func (b *grammarBuilder) declare(e common.Expr, pos lexer.Position) {
+	if _, ok := b.declared[e]; ok {
+		return
+	}
+	b.declared[e] = declaration{
+		pos:  pos,
+		root: b.libs == 0,
+	}
+	b.declOrder = append(b.declOrder, e)
+}
+
+// checkSymbols reports nonterminals without rules and symbols of the main
+// grammar that are never used. Included grammars are libraries, so their
+// unused symbols are fine.
+func (b *grammarBuilder) checkSymbols() {
+	for _, e := range b.declOrder {
+		d := b.declared[e]
+		if e.Kind == common.NTerm {
+			if _, ok := b.g.Rules[e]; !ok {
+				b.errorf(d.pos, "nonterminal %s has no $RULE", e.Value)
+				b.describe(e)
+				continue
+			}
+		}
+		if _, ok := b.used[e]; ok || !d.root || b.g.IsAxiom(e) {
+			continue
+		}
+		if e.Kind == common.Term {
+			b.warnf(d.pos, "terminal %s is declared but never used", lexer.QuoteTerm(e.Value))
+		} else {
+			b.warnf(d.pos, "nonterminal %s is declared but never used", e.Value)
+		}
+		b.describe(e)
+	}
+}
+
+// checkShapes rejects shaping that would break the parse tree layout the
+// attribute evaluator relies on.
+func (b *grammarBuilder) checkShapes() {
+	for _, axiom := range b.g.Axioms {
+		if shape := b.g.Shapes[axiom]; shape == common.ShapeInline {
+			b.errorf(b.shapePos[axiom], "axiom %s cannot be inlined", axiom.Value)
+		}
+	}
+
+	reported := make(map[common.Expr]struct{})
+	for _, p := range b.g.Productions {
+		if p.Action == "" {
+			continue
+		}
+		if shape, ok := b.g.Shapes[p.Lhs]; ok {
+			if _, ok := reported[p.Lhs]; !ok {
+				reported[p.Lhs] = struct{}{}
+				b.errorf(b.shapePos[p.Lhs], "%s cannot be shaped as %s: it has semantic rules", p.Lhs.Value, shape)
+			}
+		}
+		for _, e := range p.Rhs {
+			if shape, ok := b.g.Shapes[e]; ok {
+				if _, ok := reported[e]; !ok {
+					reported[e] = struct{}{}
+					b.errorf(b.shapePos[e], "%s cannot be shaped as %s: it is used in semantic rules of %s", e.Value, shape, p.Lhs.Value)
+				}
+			}
+		}
+	}
+}
+
+func (b *grammarBuilder) setShape(e common.Expr, shape string, pos lexer.Position) {
+	if prev, ok := b.g.Shapes[e]; ok && prev != shape {
+		b.errorf(pos, "%s is already shaped as %s", e.Value, prev)
+		return
+	}
+	b.g.Shapes[e] = shape
+	b.shapePos[e] = pos
+}
+
+// include builds the grammar file at path into the current grammar, prefixing
+// all of its nonterminals with prefix. A base grammar is included as a part
+// of the grammar itself: its axioms are kept and its rules may be extended.
+func (b *grammarBuilder) include(path, prefix string, base bool) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	for i, p := range b.chain {
+		if p == abs {
+			return fmt.Errorf("include cycle: %s", strings.Join(append(b.chain[i:], abs), " -> "))
+		}
+	}
+
+	key := abs + "\x00" + prefix
+	if base {
+		key += "\x00base"
+	}
+	if _, ok := b.included[key]; ok {
+		return nil
+	}
+	b.included[key] = struct{}{}
+
+	lex, err := lexer.NewLexer(path, false)
+	if err != nil {
+		return err
+	}
+	root, err := parse(lex, grammarTable())
+	lex.Close()
+	if err != nil {
+		// The error already starts with a position in the included file.
+		return err
+	}
+
+	depth := &b.libs
+	if base {
+		depth = &b.bases
+	}
+	b.chain = append(b.chain, abs)
+	*depth++
+	b.module(root, prefix)
+	*depth--
+	b.chain = b.chain[:len(b.chain)-1]
+
+	return nil
+}
+
+func (b *grammarBuilder) module(root *Node, prefix string) {
+	decls := declarations(root)
+
+	for _, d := range decls {
+		var err error
+		switch d.Children[0].Expr.Value {
+		case "ExtendsKeyword":
+			err = b.include(d.Children[1].Value, prefix, true)
+		case "IncludeKeyword":
+			nested := prefix
+			if ns := d.Children[2]; len(ns.Children) != 0 {
+				nested = prefix + ns.Children[0].Value + "."
+			}
+			err = b.include(d.Children[1].Value, nested, false)
+		}
+		if err != nil {
+			b.errorf(d.Children[1].Pos, "%v", err)
+		}
+	}
+
+	for _, d := range decls {
+		doc := d.Children[0].Doc
+		switch d.Children[0].Expr.Value {
+		case "AxiomKeyword":
+			axiom := ntermExpr(prefix, d.Children[1].Value)
+			b.nterms[axiom] = struct{}{}
+			b.declare(axiom, d.Children[1].Pos)
+			b.g.AddDoc(axiom, doc)
+			if b.libs == 0 {
+				b.g.AddAxiom(axiom)
+			}
+		case "NTermKeyword":
+			for _, nt := range collectList(d) {
+				nterm := ntermExpr(prefix, nt.Value)
+				b.nterms[nterm] = struct{}{}
+				b.declare(nterm, nt.Pos)
+				b.g.AddDoc(nterm, doc)
+			}
+		case "TermKeyword":
+			for _, t := range collectList(d) {
+				term := termExpr(t.Value)
+				if _, ok := b.terms[term]; !ok {
+					b.terms[term] = struct{}{}
+					b.termOrder = append(b.termOrder, term)
+				}
+				b.declare(term, t.Pos)
+				b.g.AddDoc(term, doc)
+			}
+		case "RuleKeyword":
+			name := prefix + d.Children[1].Value
+			if params := d.Children[2]; len(params.Children) != 0 {
+				b.defineTemplate(name, d, prefix)
+			} else {
+				b.g.AddDoc(ntermExpr("", name), doc)
+			}
+		}
+	}
+
+	for _, d := range decls {
+		switch d.Children[0].Expr.Value {
+		case "AttrKeyword":
+			nterm := ntermExpr(prefix, d.Children[1].Value)
+			if _, ok := b.nterms[nterm]; !ok {
+				b.errorf(d.Children[1].Pos, "attributes of undeclared nonterminal %s", nterm.Value)
+				continue
+			}
+			b.g.AddDoc(nterm, d.Children[0].Doc)
+			if prev, ok := b.g.Attributes[nterm]; ok {
+				b.g.Attributes[nterm] = prev + "; " + d.Children[2].Value
+			} else {
+				b.g.Attributes[nterm] = d.Children[2].Value
+			}
+		case "DropKeyword":
+			for _, t := range collectList(d) {
+				b.setShape(b.literal(t), common.ShapeDrop, t.Pos)
+			}
+		case "InlineKeyword", "ListKeyword":
+			shape := common.ShapeInline
+			if d.Children[0].Expr.Value == "ListKeyword" {
+				shape = common.ShapeList
+			}
+			for _, nt := range collectList(d) {
+				nterm := ntermExpr(prefix, nt.Value)
+				if _, ok := b.templates[nterm.Value]; ok {
+					b.tmplShape[nterm.Value] = shape
+					b.shapePos[nterm] = nt.Pos
+					continue
+				}
+				if _, ok := b.nterms[nterm]; !ok {
+					b.errorf(nt.Pos, "undeclared nonterminal %s", nterm.Value)
+					continue
+				}
+				b.setShape(nterm, shape, nt.Pos)
+			}
+		case "SyncKeyword":
+			b.sync(d.Children[1], prefix)
+		case "OverrideKeyword":
+			lhs := ntermExpr(prefix, d.Children[1].Value)
+			if _, ok := b.g.Rules[lhs]; !ok {
+				b.errorf(d.Children[1].Pos, "$OVERRIDE of %s, which has no rule to override", lhs.Value)
+				continue
+			}
+			b.rulePos[lhs] = ruleDef{
+				pos:  d.Children[1].Pos,
+				base: b.bases > 0,
+			}
+			if doc := d.Children[0].Doc; doc != "" {
+				b.g.Docs[lhs] = doc
+			}
+			b.g.SetRule(lhs, b.parseRule(d.Children[3], lhs, scope{prefix: prefix}))
+		case "RuleKeyword":
+			if len(d.Children[2].Children) != 0 {
+				continue
+			}
+			lhs := ntermExpr(prefix, d.Children[1].Value)
+			if _, ok := b.nterms[lhs]; !ok {
+				b.errorf(d.Children[1].Pos, "undeclared nonterminal %s", lhs.Value)
+				b.markUsed(d.Children[4], prefix)
+				continue
+			}
+			if !b.defineRule(lhs, d.Children[1].Pos) {
+				b.markUsed(d.Children[4], prefix)
+				continue
+			}
+			b.g.AddRule(lhs, b.parseRule(d.Children[4], lhs, scope{prefix: prefix}))
+		}
+	}
+}
+
+// markUsed marks the declared symbols under node as used. It keeps a
+// rejected rule from making its symbols look unused.
+func (b *grammarBuilder) markUsed(node *Node, prefix string) {
+	if node.Expr.Kind == common.Term {
+		switch node.Expr.Value {
+		case "Term":
+			b.used[termExpr(node.Value)] = struct{}{}
+		case "Nterm":
+			b.used[ntermExpr(prefix, node.Value)] = struct{}{}
+		}
+	}
+	for _, c := range node.Children {
+		b.markUsed(c, prefix)
+	}
+}
+
+// literal returns the terminal of a quoted literal, declaring it on first
+// use when it is missing from $TERM.
+func (b *grammarBuilder) literal(t *Node) common.Expr {
+	term := termExpr(t.Value)
+	if _, ok := b.terms[term]; ok {
+		return term
+	}
+	if b.opts.Strict {
+		b.warnf(t.Pos, "terminal %s is not declared in $TERM", lexer.QuoteTerm(t.Value))
+	}
+	b.terms[term] = struct{}{}
+	b.termOrder = append(b.termOrder, term)
+	b.declare(term, t.Pos)
+	return term
+}
+
+func syncList(node *Node) []*Node {
+	children := node.Children
+	if children[0].Expr.Value == "Nterm" {
+		children = children[1:]
+	}
+	res := []*Node{children[0]}
+	for tail := children[1]; len(tail.Children) != 0; tail = tail.Children[1] {
+		res = append(res, tail.Children[0])
+	}
+	return res
+}
+
+// sync records a $SYNC declaration: terminals optionally preceded by the
+// nonterminal they apply to.
+func (b *grammarBuilder) sync(node *Node, prefix string) {
+	var terms []common.Expr
+	for _, t := range syncList(node) {
+		terms = append(terms, b.literal(t))
+	}
+
+	if nt := node.Children[0]; nt.Expr.Value == "Nterm" {
+		nterm := ntermExpr(prefix, nt.Value)
+		if _, ok := b.nterms[nterm]; !ok {
+			b.errorf(nt.Pos, "undeclared nonterminal %s", nterm.Value)
+			return
+		}
+		b.g.NtermSync[nterm] = append(b.g.NtermSync[nterm], terms...)
+		return
+	}
+	b.g.Sync = append(b.g.Sync, terms...)
+}
+
+// defineRule records a $RULE definition of lhs. A repeated definition adds
+// its alternatives to the earlier ones unless the build is strict; extending
+// a rule of a base grammar is always allowed.
+func (b *grammarBuilder) defineRule(lhs common.Expr, pos lexer.Position) bool {
+	prev, ok := b.rulePos[lhs]
+	def := ruleDef{
+		pos:  pos,
+		base: b.bases > 0,
+	}
+	if !ok || prev.base && prev.pos.File != pos.File {
+		b.rulePos[lhs] = def
+		return true
+	}
+	if b.opts.Strict {
+		b.errorf(pos, "duplicate $RULE %s, first defined at %s", lhs.Value, prev.pos.ToString())
+		b.describe(lhs)
+		return false
+	}
+	return true
+}
+
+func (b *grammarBuilder) defineTemplate(name string, d *Node, prefix string) {
+	params := templateParams(d.Children[2])
+	pos := d.Children[1].Pos
+	doc := d.Children[0].Doc
+	t, ok := b.templates[name]
+	if !ok {
+		b.templates[name] = &template{
+			params: params,
+			bodies: []*Node{d.Children[4]},
+			prefix: prefix,
+			pos:    pos,
+			doc:    doc,
+		}
+		return
+	}
+
+	if b.opts.Strict {
+		b.errorf(pos, "duplicate $RULE %s, first defined at %s", name, t.pos.ToString())
+		return
+	}
+	if strings.Join(params, ",") != strings.Join(t.params, ",") {
+		b.errorf(pos, "template %s is redefined with different parameters, first defined at %s", name, t.pos.ToString())
+		return
+	}
+	t.bodies = append(t.bodies, d.Children[4])
+	if doc != "" && t.doc != "" {
+		doc = t.doc + "\n" + doc
+	}
+	if doc != "" {
+		t.doc = doc
+	}
+}
+
+func templateParams(node *Node) []string {
+	res := []string{node.Children[1].Value}
+	for tail := node.Children[2]; len(tail.Children) != 0; tail = tail.Children[2] {
+		res = append(res, tail.Children[1].Value)
+	}
+	return res
+}
+
+func templateArgs(node *Node) []*Node {
+	res := []*Node{node.Children[1].Children[0]}
+	for tail := node.Children[1].Children[1]; len(tail.Children) != 0; tail = tail.Children[2] {
+		res = append(res, tail.Children[1])
+	}
+	return res
+}
+
+func symbolText(sym, args *Node) string {
+	text := sym.Value
+	if sym.Expr.Value == "Term" {
+		text = lexer.QuoteTerm(text)
+	}
+	if args == nil || len(args.Children) == 0 {
+		return text
+	}
+
+	var parts []string
+	for _, arg := range templateArgs(args) {
+		var nested *Node
+		if len(arg.Children) > 1 {
+			nested = arg.Children[1]
+		}
+		parts = append(parts, symbolText(arg.Children[0], nested))
+	}
+	return text + "<" + strings.Join(parts, ", ") + ">"
+}
+
+func instanceName(name string, args []common.Expr) string {
+	parts := make([]string, 0, len(args))
+	for _, a := range args {
+		if a.Kind == common.Term {
+			parts = append(parts, lexer.QuoteTerm(a.Value))
+		} else {
+			parts = append(parts, a.Value)
+		}
+	}
+	return name + "<" + strings.Join(parts, ",") + ">"
+}
+
+func (b *grammarBuilder) symbol(sym, args *Node, sc scope) (common.Expr, error) {
+	if sym.Expr.Value == "Term" {
+		term := termExpr(sym.Value)
+		if _, ok := b.terms[term]; !ok {
+			if _, ok := b.nterms[ntermExpr(sc.prefix, sym.Value)]; ok {
+				return common.Expr{}, fmt.Errorf("nonterminal %s used as terminal", sym.Value)
+			}
+		}
+		b.literal(sym)
+		b.used[term] = struct{}{}
+		return term, nil
+	}
+
+	if args == nil || len(args.Children) == 0 {
+		if e, ok := sc.params[sym.Value]; ok {
+			return e, nil
+		}
+		nterm := ntermExpr(sc.prefix, sym.Value)
+		if _, ok := b.nterms[nterm]; ok {
+			b.used[nterm] = struct{}{}
+			return nterm, nil
+		}
+		if _, ok := b.templates[nterm.Value]; ok {
+			return common.Expr{}, fmt.Errorf("template %s requires arguments", nterm.Value)
+		}
+		if _, ok := b.terms[termExpr(sym.Value)]; ok {
+			return common.Expr{}, fmt.Errorf("terminal %s used as nonterminal", lexer.QuoteTerm(sym.Value))
+		}
+		return common.Expr{}, fmt.Errorf("undeclared nonterminal %s", nterm.Value)
+	}
+
+	var actual []common.Expr
+	for _, arg := range templateArgs(args) {
+		var nested *Node
+		if len(arg.Children) > 1 {
+			nested = arg.Children[1]
+		}
+		e, err := b.symbol(arg.Children[0], nested, sc)
+		if err != nil {
+			return common.Expr{}, err
+		}
+		actual = append(actual, e)
+	}
+
+	return b.instantiate(sc.prefix+sym.Value, actual)
+}
+
+// instantiate creates the nonterminal for template name applied to args,
+// building its rule on first use.
+func (b *grammarBuilder) instantiate(name string, args []common.Expr) (common.Expr, error) {
+	t, ok := b.templates[name]
+	if !ok {
+		return common.Expr{}, fmt.Errorf("%s is not a template", name)
+	}
+	if len(args) != len(t.params) {
+		return common.Expr{}, fmt.Errorf("template %s expects %d arguments, got %d", name, len(t.params), len(args))
+	}
+
+	inst := ntermExpr("", instanceName(name, args))
+	if _, ok := b.nterms[inst]; ok {
+		return inst, nil
+	}
+	if b.depth >= maxTemplateDepth {
+		return common.Expr{}, fmt.Errorf("template instantiation of %s is too deep", name)
+	}
+	b.nterms[inst] = struct{}{}
+	b.g.AddDoc(inst, t.doc)
+	if shape, ok := b.tmplShape[name]; ok {
+		b.g.Shapes[inst] = shape
+		b.shapePos[inst] = b.shapePos[ntermExpr("", name)]
+	}
+
+	sc := scope{
+		prefix: t.prefix,
+		params: make(map[string]common.Expr, len(args)),
+	}
+	for i, p := range t.params {
+		sc.params[p] = args[i]
+	}
+
+	b.depth++
+	for _, body := range t.bodies {
+		b.g.AddRule(inst, b.parseRule(body, inst, sc))
+	}
+	b.depth--
+
+	return inst, nil
+}
+
+// parseAlternative reports unresolved symbols and leaves them out of the
+// production so that the rest of the grammar can still be checked.
+func (b *grammarBuilder) parseAlternative(node *Node, lhs common.Expr, sc scope) common.Production {
+	prod := common.Production{
+		Lhs: lhs,
+	}
+	for len(node.Children) != 0 {
+		sym := node.Children[0]
+		if sym.Expr.Kind == common.NTerm {
+			node = sym
+			continue
+		}
+		switch sym.Expr.Value {
+		case "EpsKeyword":
+			prod.Rhs = append(prod.Rhs, common.Epsilon)
+		case "Label":
+			prod.Label = sym.Value
+		case "Action":
+			prod.Action = sym.Value
+		default:
+			var args *Node
+			if sym.Expr.Value == "Nterm" {
+				args = node.Children[1]
+			}
+			isTemplate := args != nil && len(args.Children) != 0
+			if isTemplate && b.depth == 0 {
+				b.site = site{
+					pos:  sym.Pos,
+					text: fmt.Sprintf("rule %s: %s", lhs.Value, symbolText(sym, args)),
+				}
+			}
+			e, err := b.symbol(sym, args, sc)
+			if err != nil {
+				if isTemplate && b.depth == 0 {
+					b.errorf(sym.Pos, "%s: %v", b.site.text, err)
+				} else {
+					b.errorf(sym.Pos, "%v", err)
+				}
+			} else {
+				prod.Rhs = append(prod.Rhs, e)
+			}
+		}
+		if len(node.Children) < 2 {
+			break
+		}
+		node = node.Children[len(node.Children)-1]
+	}
+	return prod
+}
+
+func (b *grammarBuilder) parseRule(node *Node, lhs common.Expr, sc scope) []common.Production {
+	res := []common.Production{b.parseAlternative(node.Children[0], lhs, sc)}
+
+	v2 := node.Children[1]
+	if len(v2.Children) == 0 {
+		return res
+	}
+	return append(res, b.parseRule(v2.Children[1], lhs, sc)...)
+}
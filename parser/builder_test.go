@@ -0,0 +1,215 @@
+package parser
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AlexisOMG/compilers-lab7-2/common"
+	"github.com/AlexisOMG/compilers-lab7-2/lexer"
+)
+
+// buildFiles writes files to a temporary directory, builds the grammar of
+// a.txt and returns the directory too.
+func buildFiles(t *testing.T, files map[string]string, opts Options) (*common.Grammar, []Diagnostic, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, text := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lex, err := lexer.NewLexer(filepath.Join(dir, "a.txt"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lex.Close()
+	root, err := parse(lex, grammarTable())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, diags := Diagnose(root, opts)
+	return g, diags, dir
+}
+
+// diagnose is buildFiles with the diagnostics as strings. Paths in them are
+// relative to the temporary directory.
+func diagnose(t *testing.T, files map[string]string, opts Options) (*common.Grammar, []string) {
+	t.Helper()
+	g, diags, dir := buildFiles(t, files, opts)
+	var res []string
+	for _, d := range diags {
+		res = append(res, strings.ReplaceAll(d.ToString(), dir+string(filepath.Separator), ""))
+	}
+	return g, res
+}
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		strict bool
+		// rules gives the number of alternatives of some nonterminals.
+		rules map[string]int
+		want  []string
+	}{
+		{
+			name: "namespaced include",
+			files: map[string]string{
+				"a.txt":   "$INCLUDE \"lib.txt\" lib\n$AXIOM S\n$NTERM S\n$RULE S = lib.L \"y\"\n",
+				"lib.txt": "$NTERM L M\n$TERM \"x\"\n$RULE L = \"x\"\n$RULE M = L\n",
+			},
+			rules: map[string]int{"S": 1, "lib.L": 1, "lib.M": 1},
+		},
+		{
+			name: "include cycle",
+			files: map[string]string{
+				"a.txt": "$INCLUDE \"b.txt\"\n$AXIOM S\n$NTERM S\n$RULE S = \"x\"\n",
+				"b.txt": "$INCLUDE \"a.txt\"\n",
+			},
+			want: []string{"b.txt:1:10: error: include cycle: a.txt -> b.txt -> a.txt"},
+		},
+		{
+			name: "error in included file",
+			files: map[string]string{
+				"a.txt":   "$INCLUDE \"bad.txt\"\n$AXIOM S\n$NTERM S\n$RULE S = \"x\"\n",
+				"bad.txt": "$NTERM T\n$RULE T = = \"x\"\n",
+			},
+			want: []string{"a.txt:1:10: error: bad.txt:2:11: unexpected Equal, expected: V"},
+		},
+		{
+			name: "templates",
+			files: map[string]string{
+				"a.txt": "$AXIOM S\n$NTERM S\n$TERM \"a\" \",\"\n" +
+					"$RULE List<X, Sep> = X Tail<X, Sep>\n" +
+					"$RULE Tail<X, Sep> = Sep X Tail<X, Sep>\n  $EPS\n" +
+					"$RULE S = List<\"a\", \",\">\n",
+			},
+			rules: map[string]int{"S": 1, `List<"a",",">`: 1, `Tail<"a",",">`: 2},
+		},
+		{
+			name: "template arguments",
+			files: map[string]string{
+				"a.txt": "$AXIOM S\n$NTERM S\n$TERM \"a\"\n" +
+					"$RULE Opt<X> = X\n  $EPS\n" +
+					"$RULE S = Opt<\"a\", \"a\"> Opt\n",
+			},
+			want: []string{
+				`a.txt:6:11: error: rule S: Opt<"a", "a">: template Opt expects 1 arguments, got 2`,
+				"a.txt:6:25: error: template Opt requires arguments",
+			},
+		},
+		{
+			name: "extends",
+			files: map[string]string{
+				"a.txt":    "$EXTENDS \"base.txt\"\n$TERM \"m\"\n$RULE E = \"m\"\n$OVERRIDE T = \"m\"\n",
+				"base.txt": "$AXIOM E\n$NTERM E T\n$TERM \"n\"\n$RULE E = T\n$RULE T = \"n\"\n  \"n\" T\n",
+			},
+			strict: true,
+			rules:  map[string]int{"E": 2, "T": 1},
+		},
+		{
+			name: "override without rule",
+			files: map[string]string{
+				"a.txt":    "$EXTENDS \"base.txt\"\n$NTERM F\n$OVERRIDE F = \"n\"\n",
+				"base.txt": "$AXIOM E\n$NTERM E\n$TERM \"n\"\n$RULE E = \"n\"\n",
+			},
+			want: []string{
+				"a.txt:2:8: error: nonterminal F has no $RULE",
+				"a.txt:3:11: error: $OVERRIDE of F, which has no rule to override",
+			},
+		},
+		{
+			name: "undeclared left-hand side",
+			files: map[string]string{
+				"a.txt": "$AXIOM S\n$NTERM S\n$TERM \"a\" \"q\"\n$RULE S = \"a\"\n$RULE Typo = \"q\"\n",
+			},
+			want: []string{"a.txt:5:7: error: undeclared nonterminal Typo"},
+		},
+		{
+			name: "shapes",
+			files: map[string]string{
+				"a.txt": "$AXIOM S\n$NTERM S\n$TERM \"a\"\n$RULE S = \"a\"\n$INLINE S\n$LIST S\n",
+			},
+			want: []string{
+				"a.txt:5:9: error: axiom S cannot be inlined",
+				"a.txt:6:7: error: S is already shaped as inline",
+			},
+		},
+		{
+			name: "symbols",
+			files: map[string]string{
+				"a.txt": "$AXIOM S\n$NTERM S A B C\n$TERM \"n\" \"m\"\n" +
+					"$RULE S = A \"n\" Undeclared\n$RULE A = n\n$RULE C = \"n\"\n",
+			},
+			want: []string{
+				`a.txt:2:12: error: nonterminal B has no $RULE`,
+				`a.txt:2:14: warning: nonterminal C is declared but never used`,
+				`a.txt:3:11: warning: terminal "m" is declared but never used`,
+				`a.txt:4:17: error: undeclared nonterminal Undeclared`,
+				`a.txt:5:11: error: terminal "n" used as nonterminal`,
+			},
+		},
+		{
+			name: "repeated rule",
+			files: map[string]string{
+				"a.txt": "$AXIOM E\n$NTERM E\n$TERM \"n\" \"m\"\n$RULE E = \"n\"\n$RULE E = \"m\"\n",
+			},
+			rules: map[string]int{"E": 2},
+		},
+		{
+			name: "duplicate rule",
+			files: map[string]string{
+				"a.txt": "$AXIOM E\n$NTERM E\n$TERM \"n\" \"m\"\n$RULE E = \"n\"\n$RULE E = \"m\"\n",
+			},
+			strict: true,
+			rules:  map[string]int{"E": 1},
+			want:   []string{"a.txt:5:7: error: duplicate $RULE E, first defined at a.txt:4:7"},
+		},
+		{
+			name: "inline literals",
+			files: map[string]string{
+				"a.txt": "$AXIOM E\n$NTERM E\n$RULE E = \"n\" \"+\" E\n  \"n\"\n",
+			},
+			rules: map[string]int{"E": 2},
+		},
+		{
+			name: "inline literals strict",
+			files: map[string]string{
+				"a.txt": "$AXIOM E\n$NTERM E\n$TERM \"n\"\n$RULE E = \"n\" \"+\" E\n  \"n\"\n",
+			},
+			strict: true,
+			want:   []string{`a.txt:4:15: warning: terminal "+" is not declared in $TERM`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, got := diagnose(t, test.files, Options{Strict: test.strict})
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("diagnostics:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+			for name, n := range test.rules {
+				if got := len(g.Rules[ntermExpr("", name)]); got != n {
+					t.Errorf("%s has %d alternatives, want %d", name, got, n)
+				}
+			}
+		})
+	}
+}
+
+func TestDiagnoseDocs(t *testing.T) {
+	text := "$AXIOM S\n$NTERM S\n** unused\n$NTERM U\n$TERM \"a\"\n" +
+		"** optional X\n$RULE Opt<X> = X\n  $EPS\n" +
+		"$RULE S = Opt<\"a\">\n$RULE U = \"a\"\n"
+	g, diags, _ := buildFiles(t, map[string]string{"a.txt": text}, Options{})
+	if doc := g.Docs[ntermExpr("", `Opt<"a">`)]; doc != "optional X" {
+		t.Errorf("instance doc is %q, want %q", doc, "optional X")
+	}
+	if len(diags) != 1 || diags[0].Doc != "unused" {
+		t.Errorf("diagnostics %v, want one with doc %q", diags, "unused")
+	}
+}
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AlexisOMG/compilers-lab7-2/lexer"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) ToString() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+type Diagnostic struct {
+	Pos      lexer.Position
+	Severity Severity
+	Message  string
+	// Doc is the doc comment of the symbol the diagnostic is about, if any,
+	// for editors to show on hover.
+	Doc string
+}
+
+func (d Diagnostic) ToString() string {
+	if d.Pos.Line == 0 {
+		return fmt.Sprintf("%s: %s", d.Severity.ToString(), d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Pos.ToString(), d.Severity.ToString(), d.Message)
+}
+
+// Diagnostics collects the problems found while building a grammar or
+// parsing with error recovery. It is returned as an error when at least one
+// of them is an error.
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func (ds Diagnostics) Error() string {
+	lines := make([]string, 0, len(ds))
+	for _, d := range ds {
+		lines = append(lines, d.ToString())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sort orders diagnostics by position, keeping files in the order they were
+// first reported.
+func (ds Diagnostics) sort() {
+	files := make(map[string]int)
+	for _, d := range ds {
+		if _, ok := files[d.Pos.File]; !ok {
+			files[d.Pos.File] = len(files)
+		}
+	}
+	sort.SliceStable(ds, func(i, j int) bool {
+		a, b := ds[i].Pos, ds[j].Pos
+		if a.File != b.File {
+			return files[a.File] < files[b.File]
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
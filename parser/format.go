@@ -0,0 +1,268 @@
+package parser
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AlexisOMG/compilers-lab7-2/common"
+	"github.com/AlexisOMG/compilers-lab7-2/lexer"
+)
+
+type FormatOptions struct {
+	// SortLists sorts the symbols of $NTERM and $TERM declarations instead
+	// of keeping them in declaration order.
+	SortLists bool
+}
+
+// fmtLine is a line of formatted output together with the source lines it
+// was made of, so that comments can be put back next to it.
+type fmtLine struct {
+	text  string
+	first int
+	last  int
+	decl  bool
+}
+
+// Format parses a grammar file and renders it in canonical layout: one
+// declaration per line, one alternative per line with aligned = signs and
+// the comments of the source kept in place.
+func Format(lex lexer.Lexer, opts FormatOptions) (string, error) {
+	c, commented := lex.(lexer.Commented)
+	if commented {
+		c.KeepComments()
+	}
+	root, err := parse(lex, grammarTable())
+	if err != nil {
+		return "", err
+	}
+
+	var comments []lexer.Token
+	if commented {
+		comments = c.Comments()
+	}
+
+	var lines []fmtLine
+	decls := declarations(root)
+	for i := 0; i < len(decls); i++ {
+		if !isRuleDecl(decls[i]) {
+			lines = append(lines, formatDecl(decls[i], opts))
+			continue
+		}
+
+		j := i
+		width := 0
+		for ; j < len(decls) && isRuleDecl(decls[j]); j++ {
+			if w := utf8.RuneCountInString(ruleHead(decls[j])); w > width {
+				width = w
+			}
+		}
+		for ; i < j; i++ {
+			lines = append(lines, formatRule(decls[i], width)...)
+		}
+		i--
+	}
+
+	return mergeComments(lines, comments), nil
+}
+
+func mergeComments(lines []fmtLine, comments []lexer.Token) string {
+	var sb strings.Builder
+	prev := 0
+	emit := func(text string, first, last int, block bool) {
+		if block && prev != 0 && first > prev+1 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(text)
+		sb.WriteString("\n")
+		prev = last
+	}
+
+	ci := 0
+	for _, l := range lines {
+		indent := ""
+		if !l.decl {
+			indent = l.text[:len(l.text)-len(strings.TrimLeft(l.text, " "))]
+		}
+		for ci < len(comments) && comments[ci].Pos.Line < l.first {
+			c := comments[ci]
+			emit(indent+c.Value, c.Pos.Line, c.Pos.Line, l.decl)
+			ci++
+		}
+		text := l.text
+		for ci < len(comments) && comments[ci].Pos.Line <= l.last {
+			text += " " + comments[ci].Value
+			ci++
+		}
+		emit(text, l.first, l.last, l.decl)
+	}
+	for ; ci < len(comments); ci++ {
+		c := comments[ci]
+		emit(c.Value, c.Pos.Line, c.Pos.Line, true)
+	}
+
+	return sb.String()
+}
+
+func formatAction(value string) string {
+	return "{ " + strings.TrimSpace(value) + " }"
+}
+
+// lastLine finds the line of the last token under node. Empty nonterminals
+// are skipped: they carry the position of the token after them.
+func lastLine(node *Node) int {
+	if node.Expr.Kind != common.NTerm {
+		return node.Pos.Line
+	}
+	for i := len(node.Children) - 1; i >= 0; i-- {
+		if line := lastLine(node.Children[i]); line != 0 {
+			return line
+		}
+	}
+	return 0
+}
+
+func formatList(decl *Node, sortLists bool) []string {
+	var res []string
+	for _, n := range collectList(decl) {
+		res = append(res, symbolText(n, nil))
+	}
+	if sortLists {
+		sort.Strings(res)
+	}
+	return res
+}
+
+func formatDecl(decl *Node, opts FormatOptions) fmtLine {
+	kw := decl.Children[0]
+	var parts []string
+	switch kw.Expr.Value {
+	case "AxiomKeyword":
+		parts = []string{"$AXIOM", decl.Children[1].Value}
+	case "NTermKeyword":
+		parts = append([]string{"$NTERM"}, formatList(decl, opts.SortLists)...)
+	case "TermKeyword":
+		parts = append([]string{"$TERM"}, formatList(decl, opts.SortLists)...)
+	case "DropKeyword":
+		parts = append([]string{"$DROP"}, formatList(decl, false)...)
+	case "InlineKeyword":
+		parts = append([]string{"$INLINE"}, formatList(decl, false)...)
+	case "ListKeyword":
+		parts = append([]string{"$LIST"}, formatList(decl, false)...)
+	case "AttrKeyword":
+		parts = []string{"$ATTR", decl.Children[1].Value, formatAction(decl.Children[2].Value)}
+	case "SyncKeyword":
+		parts = []string{"$SYNC"}
+		if nt := decl.Children[1].Children[0]; nt.Expr.Value == "Nterm" {
+			parts = append(parts, nt.Value)
+		}
+		for _, t := range syncList(decl.Children[1]) {
+			parts = append(parts, symbolText(t, nil))
+		}
+	case "ExtendsKeyword":
+		parts = []string{"$EXTENDS", lexer.QuoteTerm(includePath(decl.Children[1]))}
+	case "IncludeKeyword":
+		parts = []string{"$INCLUDE", lexer.QuoteTerm(includePath(decl.Children[1]))}
+		if ns := decl.Children[2]; len(ns.Children) != 0 {
+			parts = append(parts, ns.Children[0].Value)
+		}
+	}
+
+	return fmtLine{
+		text:  strings.Join(parts, " "),
+		first: kw.Pos.Line,
+		last:  lastLine(decl),
+		decl:  true,
+	}
+}
+
+// includePath undoes the lexer resolving include paths against the
+// directory of the including file.
+func includePath(term *Node) string {
+	dir := filepath.Dir(term.Pos.File)
+	if filepath.IsAbs(term.Value) && !filepath.IsAbs(dir) {
+		return term.Value
+	}
+	rel, err := filepath.Rel(dir, term.Value)
+	if err != nil {
+		return term.Value
+	}
+	return filepath.ToSlash(rel)
+}
+
+func isRuleDecl(decl *Node) bool {
+	kw := decl.Children[0].Expr.Value
+	return kw == "RuleKeyword" || kw == "OverrideKeyword"
+}
+
+// ruleHead renders a rule declaration up to the = sign.
+func ruleHead(decl *Node) string {
+	if decl.Children[0].Expr.Value == "OverrideKeyword" {
+		return "$OVERRIDE " + decl.Children[1].Value
+	}
+	lhs := "$RULE " + decl.Children[1].Value
+	if params := decl.Children[2]; len(params.Children) != 0 {
+		lhs += "<" + strings.Join(templateParams(params), ", ") + ">"
+	}
+	return lhs
+}
+
+func formatRule(decl *Node, width int) []fmtLine {
+	lhs := ruleHead(decl)
+	head := lhs + strings.Repeat(" ", width-utf8.RuneCountInString(lhs)) + " = "
+	indent := strings.Repeat(" ", utf8.RuneCountInString(head))
+
+	var res []fmtLine
+	for node := decl.Children[len(decl.Children)-1]; ; node = node.Children[1].Children[1] {
+		l := formatAlternative(node.Children[0])
+		if len(res) == 0 {
+			l.text = head + l.text
+			l.first = decl.Children[0].Pos.Line
+			l.decl = true
+		} else {
+			l.text = indent + l.text
+		}
+		res = append(res, l)
+		if len(node.Children[1].Children) == 0 {
+			break
+		}
+	}
+	return res
+}
+
+func formatAlternative(node *Node) fmtLine {
+	var parts []string
+	res := fmtLine{}
+	for len(node.Children) != 0 {
+		sym := node.Children[0]
+		if sym.Expr.Kind == common.NTerm {
+			node = sym
+			continue
+		}
+		switch sym.Expr.Value {
+		case "EpsKeyword":
+			parts = append(parts, "$EPS")
+		case "Label":
+			parts = append(parts, "#"+sym.Value)
+		case "Action":
+			parts = append(parts, formatAction(sym.Value))
+		default:
+			var args *Node
+			if sym.Expr.Value == "Nterm" {
+				args = node.Children[1]
+			}
+			parts = append(parts, symbolText(sym, args))
+		}
+		if res.first == 0 {
+			res.first = sym.Pos.Line
+		}
+		res.last = sym.Pos.Line
+		if len(node.Children) < 2 {
+			break
+		}
+		node = node.Children[len(node.Children)-1]
+	}
+	res.text = strings.Join(parts, " ")
+	return res
+}
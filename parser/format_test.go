@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/AlexisOMG/compilers-lab7-2/lexer"
+)
+
+func format(t *testing.T, src string, opts FormatOptions) string {
+	t.Helper()
+	out, err := Format(lexer.NewStringLexer(src, "grammar.txt", false), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		sort bool
+		want string
+	}{
+		{
+			name: "layout",
+			src:  "$AXIOM   E\n$NTERM T E\n$TERM \"n\"   \"+\"\n$RULE E = T \"+\" E\n   T\n$RULE   Term=\"n\" {  $0.v = 1 }\n",
+			want: "$AXIOM E\n$NTERM T E\n$TERM \"n\" \"+\"\n" +
+				"$RULE E    = T \"+\" E\n" +
+				"             T\n" +
+				"$RULE Term = \"n\" { $0.v = 1 }\n",
+		},
+		{
+			name: "sorted lists",
+			src:  "$AXIOM E\n$NTERM T E\n$TERM \"n\" \"+\"\n$RULE E = T\n",
+			sort: true,
+			want: "$AXIOM E\n$NTERM E T\n$TERM \"+\" \"n\"\n$RULE E = T\n",
+		},
+		{
+			name: "comments",
+			src:  "* header\n$AXIOM E\n\n\n* rules\n** doc\n$RULE E = \"n\" * first\n  \"+\"   * second\n* end\n",
+			want: "* header\n$AXIOM E\n\n* rules\n** doc\n$RULE E = \"n\" * first\n          \"+\" * second\n* end\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := FormatOptions{SortLists: test.sort}
+			got := format(t, test.src, opts)
+			if got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+			if again := format(t, got, opts); again != got {
+				t.Errorf("formatting is not idempotent:\n%s", again)
+			}
+		})
+	}
+}
+
+// TestFormatFiles checks that the grammars of the repository are formatted.
+func TestFormatFiles(t *testing.T) {
+	for _, path := range []string{"../test.txt", "../selfmade.txt"} {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := format(t, string(src), FormatOptions{}); got != string(src) {
+			t.Errorf("%s is not formatted:\n%s", path, got)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"strings"
+
+	"github.com/AlexisOMG/compilers-lab7-2/common"
+	"github.com/AlexisOMG/compilers-lab7-2/lexer"
+)
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("grammar").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Grammar reference</title>
+<style>.doc { white-space: pre-line; }</style>
+</head>
+<body>
+<h1>Grammar reference</h1>
+<h2>Nonterminals</h2>
+{{range .Nterms}}<h3 id="{{.Name}}">{{.Name}}{{if .Axiom}} (axiom){{end}}</h3>
+{{if .Doc}}<p class="doc">{{.Doc}}</p>
+{{end}}<pre>{{range .Alts}}{{.}}
+{{end}}</pre>
+{{end}}<h2>Terminals</h2>
+<dl>
+{{range .Terms}}<dt><code>{{.Name}}</code></dt>
+{{if .Doc}}<dd class="doc">{{.Doc}}</dd>
+{{end}}{{end}}</dl>
+</body>
+</html>
+`))
+
+type htmlSymbol struct {
+	Name  string
+	Axiom bool
+	Doc   string
+	Alts  []string
+}
+
+func alternativeText(p common.Production) string {
+	var parts []string
+	for _, e := range p.Rhs {
+		switch e.Kind {
+		case common.Eps:
+			parts = append(parts, "$EPS")
+		case common.Term:
+			parts = append(parts, lexer.QuoteTerm(e.Value))
+		default:
+			parts = append(parts, e.Value)
+		}
+	}
+	if p.Label != "" {
+		parts = append(parts, "#"+p.Label)
+	}
+	return strings.Join(parts, " ")
+}
+
+// WriteHTML renders a reference page of g: every nonterminal with its doc
+// comment and alternatives, then the terminals.
+func WriteHTML(w io.Writer, g *common.Grammar) error {
+	var data struct {
+		Nterms []*htmlSymbol
+		Terms  []*htmlSymbol
+	}
+
+	nterms := make(map[common.Expr]*htmlSymbol)
+	for _, p := range g.Productions {
+		sym, ok := nterms[p.Lhs]
+		if !ok {
+			sym = &htmlSymbol{
+				Name:  p.Lhs.Value,
+				Axiom: g.IsAxiom(p.Lhs),
+				Doc:   g.Docs[p.Lhs],
+			}
+			nterms[p.Lhs] = sym
+			data.Nterms = append(data.Nterms, sym)
+		}
+		sym.Alts = append(sym.Alts, alternativeText(p))
+	}
+
+	for _, t := range g.Terminals {
+		data.Terms = append(data.Terms, &htmlSymbol{
+			Name: lexer.QuoteTerm(t.Value),
+			Doc:  g.Docs[t],
+		})
+	}
+
+	return htmlTemplate.Execute(w, data)
+}
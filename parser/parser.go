@@ -2,6 +2,7 @@ package parser
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"strings"
@@ -11,21 +12,26 @@ import (
 )
 
 var (
+	Axiom = common.Expr{
+		Kind:  common.NTerm,
+		Value: "S",
+	}
+
 	Rules = common.Rules{
 		common.Expr{
 			Kind:  common.NTerm,
 			Value: "S",
 		}: [][]common.Expr{
 			{
-				{"AxiomKeyword", common.Term}, {"Nterm", common.Term}, {"NTermKeyword", common.Term}, {"Nterm", common.Term}, {"N", common.NTerm}, {"T", common.NTerm}, {"R", common.NTerm},
+				{Value: "D", Kind: common.NTerm}, {Value: "R1", Kind: common.NTerm},
 			},
 		},
 		common.Expr{
 			Kind:  common.NTerm,
-			Value: "N",
+			Value: "R1",
 		}: [][]common.Expr{
 			{
-				{"Nterm", common.Term}, {"N", common.NTerm},
+				{Value: "D", Kind: common.NTerm}, {Value: "R1", Kind: common.NTerm},
 			},
 			{
 				common.Epsilon,
@@ -33,18 +39,51 @@ var (
 		},
 		common.Expr{
 			Kind:  common.NTerm,
-			Value: "T",
+			Value: "D",
 		}: [][]common.Expr{
 			{
-				{"TermKeyword", common.Term}, {"Term", common.Term}, {"T1", common.NTerm},
+				{Value: "AxiomKeyword", Kind: common.Term}, {Value: "Nterm", Kind: common.Term},
+			},
+			{
+				{Value: "NTermKeyword", Kind: common.Term}, {Value: "Nterm", Kind: common.Term}, {Value: "N", Kind: common.NTerm},
+			},
+			{
+				{Value: "TermKeyword", Kind: common.Term}, {Value: "Term", Kind: common.Term}, {Value: "T1", Kind: common.NTerm},
+			},
+			{
+				{Value: "AttrKeyword", Kind: common.Term}, {Value: "Nterm", Kind: common.Term}, {Value: "Action", Kind: common.Term},
+			},
+			{
+				{Value: "RuleKeyword", Kind: common.Term}, {Value: "Nterm", Kind: common.Term}, {Value: "P", Kind: common.NTerm}, {Value: "Equal", Kind: common.Term}, {Value: "V", Kind: common.NTerm},
+			},
+			{
+				{Value: "IncludeKeyword", Kind: common.Term}, {Value: "Term", Kind: common.Term}, {Value: "I1", Kind: common.NTerm},
+			},
+			{
+				{Value: "DropKeyword", Kind: common.Term}, {Value: "Term", Kind: common.Term}, {Value: "T1", Kind: common.NTerm},
+			},
+			{
+				{Value: "InlineKeyword", Kind: common.Term}, {Value: "Nterm", Kind: common.Term}, {Value: "N", Kind: common.NTerm},
+			},
+			{
+				{Value: "ListKeyword", Kind: common.Term}, {Value: "Nterm", Kind: common.Term}, {Value: "N", Kind: common.NTerm},
+			},
+			{
+				{Value: "SyncKeyword", Kind: common.Term}, {Value: "Y", Kind: common.NTerm},
+			},
+			{
+				{Value: "ExtendsKeyword", Kind: common.Term}, {Value: "Term", Kind: common.Term},
+			},
+			{
+				{Value: "OverrideKeyword", Kind: common.Term}, {Value: "Nterm", Kind: common.Term}, {Value: "Equal", Kind: common.Term}, {Value: "V", Kind: common.NTerm},
 			},
 		},
 		common.Expr{
 			Kind:  common.NTerm,
-			Value: "T1",
+			Value: "I1",
 		}: [][]common.Expr{
 			{
-				{"Term", common.Term}, {"T1", common.NTerm},
+				{Value: "Nterm", Kind: common.Term},
 			},
 			{
 				common.Epsilon,
@@ -52,18 +91,21 @@ var (
 		},
 		common.Expr{
 			Kind:  common.NTerm,
-			Value: "R",
+			Value: "N",
 		}: [][]common.Expr{
 			{
-				{"R'", common.NTerm}, {"R1", common.NTerm},
+				{Value: "Nterm", Kind: common.Term}, {Value: "N", Kind: common.NTerm},
+			},
+			{
+				common.Epsilon,
 			},
 		},
 		common.Expr{
 			Kind:  common.NTerm,
-			Value: "R1",
+			Value: "T1",
 		}: [][]common.Expr{
 			{
-				{"R'", common.NTerm}, {"R1", common.NTerm},
+				{Value: "Term", Kind: common.Term}, {Value: "T1", Kind: common.NTerm},
 			},
 			{
 				common.Epsilon,
@@ -71,10 +113,24 @@ var (
 		},
 		common.Expr{
 			Kind:  common.NTerm,
-			Value: "R'",
+			Value: "P",
 		}: [][]common.Expr{
 			{
-				{"RuleKeyword", common.Term}, {"Nterm", common.Term}, {"Equal", common.Term}, {"V", common.NTerm},
+				{Value: "Less", Kind: common.Term}, {Value: "Nterm", Kind: common.Term}, {Value: "P1", Kind: common.NTerm}, {Value: "Greater", Kind: common.Term},
+			},
+			{
+				common.Epsilon,
+			},
+		},
+		common.Expr{
+			Kind:  common.NTerm,
+			Value: "P1",
+		}: [][]common.Expr{
+			{
+				{Value: "Comma", Kind: common.Term}, {Value: "Nterm", Kind: common.Term}, {Value: "P1", Kind: common.NTerm},
+			},
+			{
+				common.Epsilon,
 			},
 		},
 		common.Expr{
@@ -82,7 +138,7 @@ var (
 			Value: "V",
 		}: [][]common.Expr{
 			{
-				{"V1", common.NTerm}, {"V2", common.NTerm},
+				{Value: "V1", Kind: common.NTerm}, {Value: "V2", Kind: common.NTerm},
 			},
 		},
 		common.Expr{
@@ -90,13 +146,13 @@ var (
 			Value: "V1",
 		}: [][]common.Expr{
 			{
-				{"Term", common.Term}, {"V3", common.NTerm},
+				{Value: "Term", Kind: common.Term}, {Value: "V3", Kind: common.NTerm},
 			},
 			{
-				{"Nterm", common.Term}, {"V3", common.NTerm},
+				{Value: "Nterm", Kind: common.Term}, {Value: "A", Kind: common.NTerm}, {Value: "V3", Kind: common.NTerm},
 			},
 			{
-				{"EpsKeyword", common.Term},
+				{Value: "EpsKeyword", Kind: common.Term}, {Value: "V5", Kind: common.NTerm},
 			},
 		},
 		common.Expr{
@@ -104,10 +160,35 @@ var (
 			Value: "V3",
 		}: [][]common.Expr{
 			{
-				{"Term", common.Term}, {"V3", common.NTerm},
+				{Value: "Term", Kind: common.Term}, {Value: "V3", Kind: common.NTerm},
+			},
+			{
+				{Value: "Nterm", Kind: common.Term}, {Value: "A", Kind: common.NTerm}, {Value: "V3", Kind: common.NTerm},
+			},
+			{
+				{Value: "V5", Kind: common.NTerm},
+			},
+		},
+		common.Expr{
+			Kind:  common.NTerm,
+			Value: "V5",
+		}: [][]common.Expr{
+			{
+				{Value: "Label", Kind: common.Term}, {Value: "V4", Kind: common.NTerm},
 			},
 			{
-				{"Nterm", common.Term}, {"V3", common.NTerm},
+				{Value: "Action", Kind: common.Term},
+			},
+			{
+				common.Epsilon,
+			},
+		},
+		common.Expr{
+			Kind:  common.NTerm,
+			Value: "V4",
+		}: [][]common.Expr{
+			{
+				{Value: "Action", Kind: common.Term},
 			},
 			{
 				common.Epsilon,
@@ -118,30 +199,96 @@ var (
 			Value: "V2",
 		}: [][]common.Expr{
 			{
-				{"NewLine", common.Term}, {"V", common.NTerm},
+				{Value: "NewLine", Kind: common.Term}, {Value: "V", Kind: common.NTerm},
 			},
 			{
 				common.Epsilon,
 			},
 		},
+		common.Expr{
+			Kind:  common.NTerm,
+			Value: "A",
+		}: [][]common.Expr{
+			{
+				{Value: "Less", Kind: common.Term}, {Value: "G", Kind: common.NTerm}, {Value: "Greater", Kind: common.Term},
+			},
+			{
+				common.Epsilon,
+			},
+		},
+		common.Expr{
+			Kind:  common.NTerm,
+			Value: "G",
+		}: [][]common.Expr{
+			{
+				{Value: "G2", Kind: common.NTerm}, {Value: "G1", Kind: common.NTerm},
+			},
+		},
+		common.Expr{
+			Kind:  common.NTerm,
+			Value: "G1",
+		}: [][]common.Expr{
+			{
+				{Value: "Comma", Kind: common.Term}, {Value: "G2", Kind: common.NTerm}, {Value: "G1", Kind: common.NTerm},
+			},
+			{
+				common.Epsilon,
+			},
+		},
+		common.Expr{
+			Kind:  common.NTerm,
+			Value: "G2",
+		}: [][]common.Expr{
+			{
+				{Value: "Term", Kind: common.Term},
+			},
+			{
+				{Value: "Nterm", Kind: common.Term}, {Value: "A", Kind: common.NTerm},
+			},
+		},
+		common.Expr{
+			Kind:  common.NTerm,
+			Value: "Y",
+		}: [][]common.Expr{
+			{
+				{Value: "Term", Kind: common.Term}, {Value: "T1", Kind: common.NTerm},
+			},
+			{
+				{Value: "Nterm", Kind: common.Term}, {Value: "Term", Kind: common.Term}, {Value: "T1", Kind: common.NTerm},
+			},
+		},
 	}
 
 	Terminals = []common.Expr{
-		{"AxiomKeyword", common.Term},
-		{"NTermKeyword", common.Term},
-		{"TermKeyword", common.Term},
-		{"RuleKeyword", common.Term},
-		{"EpsKeyword", common.Term},
-		{"Equal", common.Term},
-		{"NewLine", common.Term},
-		{"Term", common.Term},
-		{"Nterm", common.Term},
+		{Value: "AxiomKeyword", Kind: common.Term},
+		{Value: "NTermKeyword", Kind: common.Term},
+		{Value: "TermKeyword", Kind: common.Term},
+		{Value: "RuleKeyword", Kind: common.Term},
+		{Value: "EpsKeyword", Kind: common.Term},
+		{Value: "AttrKeyword", Kind: common.Term},
+		{Value: "IncludeKeyword", Kind: common.Term},
+		{Value: "DropKeyword", Kind: common.Term},
+		{Value: "InlineKeyword", Kind: common.Term},
+		{Value: "ListKeyword", Kind: common.Term},
+		{Value: "SyncKeyword", Kind: common.Term},
+		{Value: "ExtendsKeyword", Kind: common.Term},
+		{Value: "OverrideKeyword", Kind: common.Term},
+		{Value: "Equal", Kind: common.Term},
+		{Value: "Action", Kind: common.Term},
+		{Value: "Less", Kind: common.Term},
+		{Value: "Greater", Kind: common.Term},
+		{Value: "Comma", Kind: common.Term},
+		{Value: "Label", Kind: common.Term},
+		{Value: "NewLine", Kind: common.Term},
+		{Value: "Term", Kind: common.Term},
+		{Value: "Nterm", Kind: common.Term},
 	}
 )
 
 type Transition struct {
 	Term   common.Expr   `json:"term"`
 	Nterms []common.Expr `json:"nterms"`
+	Label  string        `json:"label,omitempty"`
 }
 
 type Rule struct {
@@ -149,15 +296,55 @@ type Rule struct {
 	Transitions []Transition `json:"transitions"`
 }
 
-type TableInfo struct {
+type Attribute struct {
+	Nterm common.Expr `json:"nterm"`
+	Decl  string      `json:"decl"`
+}
+
+type Shape struct {
+	Expr  common.Expr `json:"expr"`
+	Shape string      `json:"shape"`
+}
+
+// SyncSet lists synchronizing terminals of Nterm, or of the whole grammar
+// when Nterm is nil.
+type SyncSet struct {
+	Nterm *common.Expr  `json:"nterm,omitempty"`
+	Terms []common.Expr `json:"terms"`
+}
+
+type Doc struct {
+	Expr common.Expr `json:"expr"`
+	Text string      `json:"text"`
+}
+
+type Entry struct {
 	Axiom common.Expr `json:"axiom"`
 	Rules []Rule      `json:"rules"`
 }
 
-func SaveTableInfo(pathToFile string, table common.Table, axiom common.Expr) error {
-	tInfo := TableInfo{
-		Axiom: axiom,
+// TableInfo keeps the table of the first axiom in Axiom and Rules; tables of
+// the other entry points are stored in Entries.
+type TableInfo struct {
+	Axiom       common.Expr         `json:"axiom"`
+	Rules       []Rule              `json:"rules"`
+	Entries     []Entry             `json:"entries,omitempty"`
+	Attributes  []Attribute         `json:"attributes,omitempty"`
+	Productions []common.Production `json:"productions,omitempty"`
+	Shapes      []Shape             `json:"shapes,omitempty"`
+	Sync        []SyncSet           `json:"sync,omitempty"`
+	Docs        []Doc               `json:"docs,omitempty"`
+}
+
+func (ti *TableInfo) AttributeMap() map[common.Expr]string {
+	res := make(map[common.Expr]string, len(ti.Attributes))
+	for _, a := range ti.Attributes {
+		res[a.Nterm] = a.Decl
 	}
+	return res
+}
+
+func tableRules(table common.Table, g *common.Grammar) []Rule {
 	var rls []Rule
 	for nterm := range table {
 		rl := Rule{
@@ -165,52 +352,223 @@ func SaveTableInfo(pathToFile string, table common.Table, axiom common.Expr) err
 		}
 		var trans []Transition
 		for t := range table[nterm] {
-			trans = append(trans, Transition{
+			tr := Transition{
 				Term:   t,
 				Nterms: table[nterm][t][0],
-			})
+			}
+			if p, ok := g.Production(nterm, tr.Nterms); ok {
+				tr.Label = p.Label
+			}
+			trans = append(trans, tr)
 		}
 		rl.Transitions = trans
 		rls = append(rls, rl)
 	}
-	tInfo.Rules = rls
+	return rls
+}
+
+func SaveTableInfo(pathToFile string, g *common.Grammar) error {
+	var tInfo TableInfo
+	for i, axiom := range g.Axioms {
+		rls := tableRules(g.Table(axiom), g)
+		if i == 0 {
+			tInfo.Axiom = axiom
+			tInfo.Rules = rls
+		} else {
+			tInfo.Entries = append(tInfo.Entries, Entry{
+				Axiom: axiom,
+				Rules: rls,
+			})
+		}
+	}
+
+	for nterm, decl := range g.Attributes {
+		tInfo.Attributes = append(tInfo.Attributes, Attribute{
+			Nterm: nterm,
+			Decl:  decl,
+		})
+	}
+	if len(tInfo.Attributes) > 0 {
+		tInfo.Productions = g.Productions
+	}
+
+	for e, shape := range g.Shapes {
+		tInfo.Shapes = append(tInfo.Shapes, Shape{
+			Expr:  e,
+			Shape: shape,
+		})
+	}
+
+	if len(g.Sync) > 0 {
+		tInfo.Sync = append(tInfo.Sync, SyncSet{
+			Terms: g.Sync,
+		})
+	}
+	for nterm, terms := range g.NtermSync {
+		nterm := nterm
+		tInfo.Sync = append(tInfo.Sync, SyncSet{
+			Nterm: &nterm,
+			Terms: terms,
+		})
+	}
+
+	for e, text := range g.Docs {
+		tInfo.Docs = append(tInfo.Docs, Doc{
+			Expr: e,
+			Text: text,
+		})
+	}
+
 	data, err := json.Marshal(tInfo)
 	if err != nil {
 		return err
 	}
 
-	ioutil.WriteFile(pathToFile, data, 0777)
-	return err
+	return ioutil.WriteFile(pathToFile, data, 0777)
 }
 
-func LoadTableFromFile(pathToFile string) (common.Table, common.Expr, error) {
+func LoadTableInfo(pathToFile string) (*TableInfo, error) {
 	var tableInfo TableInfo
 	data, err := ioutil.ReadFile(pathToFile)
 	if err != nil {
-		return nil, common.Expr{}, err
+		return nil, err
 	}
 
 	if err := json.Unmarshal(data, &tableInfo); err != nil {
-		return nil, common.Expr{}, err
+		return nil, err
+	}
+
+	return &tableInfo, nil
+}
+
+type parsingTable struct {
+	axiom     common.Expr
+	table     common.Table
+	labels    map[common.Expr]map[common.Expr]string
+	shapes    map[common.Expr]string
+	sync      map[common.Expr]struct{}
+	ntermSync map[common.Expr]map[common.Expr]struct{}
+}
+
+// newParsingTable selects the table of entry; an empty entry means the first
+// axiom of the grammar.
+func newParsingTable(tableInfo *TableInfo, entry string) (*parsingTable, error) {
+	axiom, rules := tableInfo.Axiom, tableInfo.Rules
+	if entry != "" && entry != axiom.Value {
+		found := false
+		for _, e := range tableInfo.Entries {
+			if e.Axiom.Value == entry {
+				axiom, rules = e.Axiom, e.Rules
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown entry point: %s", entry)
+		}
 	}
 
-	res := make(common.Table)
+	res := &parsingTable{
+		axiom:     axiom,
+		table:     make(common.Table),
+		labels:    make(map[common.Expr]map[common.Expr]string),
+		shapes:    make(map[common.Expr]string, len(tableInfo.Shapes)),
+		sync:      make(map[common.Expr]struct{}),
+		ntermSync: make(map[common.Expr]map[common.Expr]struct{}),
+	}
 
-	for _, rls := range tableInfo.Rules {
-		res[rls.Nterm] = make(map[common.Expr][][]common.Expr)
+	for _, sh := range tableInfo.Shapes {
+		res.shapes[sh.Expr] = sh.Shape
+	}
+
+	for _, set := range tableInfo.Sync {
+		terms := res.sync
+		if set.Nterm != nil {
+			if res.ntermSync[*set.Nterm] == nil {
+				res.ntermSync[*set.Nterm] = make(map[common.Expr]struct{})
+			}
+			terms = res.ntermSync[*set.Nterm]
+		}
+		for _, t := range set.Terms {
+			terms[t] = struct{}{}
+		}
+	}
+
+	for _, rls := range rules {
+		res.table[rls.Nterm] = make(map[common.Expr][][]common.Expr)
+		res.labels[rls.Nterm] = make(map[common.Expr]string)
 		for _, trans := range rls.Transitions {
-			res[rls.Nterm][trans.Term] = append(res[rls.Nterm][trans.Term], trans.Nterms)
+			res.table[rls.Nterm][trans.Term] = append(res.table[rls.Nterm][trans.Term], trans.Nterms)
+			if trans.Label != "" {
+				res.labels[rls.Nterm][trans.Term] = trans.Label
+			}
 		}
 	}
 
-	return res, tableInfo.Axiom, nil
+	return res, nil
+}
+
+func LoadTableFromFile(pathToFile string) (common.Table, common.Expr, error) {
+	tableInfo, err := LoadTableInfo(pathToFile)
+	if err != nil {
+		return nil, common.Expr{}, err
+	}
+
+	pt, err := newParsingTable(tableInfo, "")
+	if err != nil {
+		return nil, common.Expr{}, err
+	}
+	return pt.table, pt.axiom, nil
 }
 
 type Node struct {
 	Expr     common.Expr
 	Rule     []common.Expr
+	Label    string
 	Value    string
+	Pos      lexer.Position
+	Doc      string
 	Children []*Node
+	// Text, Leading and Trailing of leaves come from the token. Text of
+	// tokens that got no node is kept in the trivia of the next leaf.
+	Text     string
+	Leading  string
+	Trailing string
+	// Literal is the parsed value of the token of a leaf, if it has one.
+	Literal interface{}
+}
+
+// Source prints the tree back as it was in the input. It is exact when the
+// lexer kept trivia.
+func (n *Node) Source() string {
+	var sb strings.Builder
+	n.writeSource(&sb)
+	return sb.String()
+}
+
+func (n *Node) writeSource(sb *strings.Builder) {
+	sb.WriteString(n.Leading)
+	sb.WriteString(n.Text)
+	for _, c := range n.Children {
+		c.writeSource(sb)
+	}
+	sb.WriteString(n.Trailing)
+}
+
+func lastLeaf(n *Node) *Node {
+	if n.Expr.Kind != common.NTerm {
+		return n
+	}
+	for i := len(n.Children) - 1; i >= 0; i-- {
+		if leaf := lastLeaf(n.Children[i]); leaf != nil {
+			return leaf
+		}
+	}
+	return nil
+}
+
+func tokenSource(tok lexer.Token) string {
+	return tok.Leading + tok.Text + tok.Trailing
 }
 
 func (n *Node) Print(depth int) {
@@ -220,6 +578,9 @@ func (n *Node) Print(depth int) {
 		for _, r := range n.Rule {
 			fmt.Print(r.Value, " ")
 		}
+		if n.Label != "" {
+			fmt.Print("#", n.Label)
+		}
 		// fmt.Print("\n\tChildren: ")
 		// for _, child := range n.Children {
 		// 	fmt.Print(child.Expr.Value, " ")
@@ -241,11 +602,66 @@ type stackItem struct {
 
 type stack []stackItem
 
-func Parse(lex lexer.Lexer, pathToFile string) (*Node, error) {
-	table, axiom, err := LoadTableFromFile(pathToFile)
+func lexicalError(lex lexer.Lexer, tok lexer.Token) Diagnostic {
+	d := Diagnostic{
+		Pos:      tok.Pos,
+		Severity: SeverityError,
+		Message:  fmt.Sprintf("unexpected %s %q", tok.Kind.ToString(), tok.Value),
+	}
+	var lexErr *lexer.LexError
+	if err := lex.Err(); errors.As(err, &lexErr) {
+		d.Pos, d.Message = lexErr.Pos, lexErr.Msg
+	} else if err != nil {
+		d.Message = err.Error()
+	}
+	return d
+}
+
+// Parse parses the input from the entry nonterminal; an empty entry means the
+// first axiom of the grammar.
+func Parse(lex lexer.Lexer, pathToFile string, entry string) (*Node, error) {
+	tableInfo, err := LoadTableInfo(pathToFile)
 	if err != nil {
 		return nil, err
 	}
+	pt, err := newParsingTable(tableInfo, entry)
+	if err != nil {
+		return nil, err
+	}
+	return parse(lex, pt)
+}
+
+// recovers reports whether the grammar declares synchronizing terminals;
+// without them the parser stops at the first syntax error.
+func (pt *parsingTable) recovers() bool {
+	return len(pt.sync) > 0 || len(pt.ntermSync) > 0
+}
+
+// isSync reports whether the parser may give up on x and resume at t.
+func (pt *parsingTable) isSync(x stackItem, t common.Expr) bool {
+	if t == common.Dollar {
+		return true
+	}
+	owner := x.expr
+	if owner.Kind == common.Term {
+		owner = x.parent.Expr
+	}
+	if _, ok := pt.ntermSync[owner][t]; ok {
+		return true
+	}
+	_, ok := pt.sync[t]
+	return ok
+}
+
+func (pt *parsingTable) predict(x, t common.Expr) ([]common.Expr, bool) {
+	exprs, ok := pt.table[x][t]
+	if !ok || exprs[0][0] == common.Error {
+		return nil, false
+	}
+	return exprs[0], true
+}
+
+func parse(lex lexer.Lexer, pt *parsingTable) (*Node, error) {
 	var st stack
 	fakeRoot := Node{
 		Expr: common.Expr{
@@ -258,15 +674,88 @@ func Parse(lex lexer.Lexer, pathToFile string) (*Node, error) {
 		parent: &fakeRoot,
 	},
 		stackItem{
-			expr:   axiom,
+			expr:   pt.axiom,
 			parent: &fakeRoot,
 		},
 	)
 
-	a := lex.NextToken()
-	if a.Kind == lexer.Error {
-		return nil, fmt.Errorf("syntax error: %v", a)
+	// Errors right after a recovery are usually caused by it, so nothing is
+	// reported again until a token is matched.
+	var errs Diagnostics
+	quiet := false
+	report := func(tok lexer.Token, err error) {
+		if quiet {
+			return
+		}
+		quiet = true
+		errs = append(errs, Diagnostic{
+			Pos:      tok.Pos,
+			Severity: SeverityError,
+			Message:  err.Error(),
+		})
 	}
+
+	// skipped is the source of the tokens read since the last leaf that got
+	// no node of their own.
+	skipped := ""
+
+	// Lexical errors are all reported and their tokens dropped, so that one
+	// run finds every bad piece of the input.
+	next := func() lexer.Token {
+		for {
+			tok := lex.NextToken()
+			if tok.Kind != lexer.Error {
+				return tok
+			}
+			skipped += tokenSource(tok)
+			errs = append(errs, lexicalError(lex, tok))
+		}
+	}
+	// fail ends the parse at a syntax error when there is no recovery. The
+	// rest of the input is still read to report all of its lexical errors.
+	fail := func(tok lexer.Token, err error) (*Node, error) {
+		for t := tok; t.Kind != lexer.EOF; {
+			t = next()
+		}
+		if len(errs) == 0 {
+			return nil, fmt.Errorf("%s: %v", tok.Pos.ToString(), err)
+		}
+		errs = append(errs, Diagnostic{
+			Pos:      tok.Pos,
+			Severity: SeverityError,
+			Message:  err.Error(),
+		})
+		errs.sort()
+		return nil, errs
+	}
+
+	a := next()
+	// skip drops input until x can go on or the parser may resynchronize.
+	skip := func(x stackItem) {
+		for {
+			if x.expr.Kind == common.Term && x.expr.Value == a.Kind.ToString() {
+				return
+			}
+			if _, ok := pt.predict(x.expr, a.ToExpr()); ok && x.expr.Kind == common.NTerm {
+				return
+			}
+			if pt.isSync(x, a.ToExpr()) {
+				return
+			}
+			skipped += tokenSource(a)
+			a = next()
+		}
+	}
+	// resume puts x back when skipping reached a token it accepts; otherwise
+	// x is abandoned at a synchronizing token.
+	resume := func(x stackItem) {
+		if x.expr.Kind == common.Term && x.expr.Value == a.Kind.ToString() {
+			st = append(st, x)
+		} else if _, ok := pt.predict(x.expr, a.ToExpr()); ok && x.expr.Kind == common.NTerm {
+			st = append(st, x)
+		}
+	}
+
 	for st[len(st)-1].expr != common.Dollar {
 		// fmt.Println(a.ToExpr())
 		x := st[len(st)-1]
@@ -275,179 +764,80 @@ func Parse(lex lexer.Lexer, pathToFile string) (*Node, error) {
 		st = st[:len(st)-1]
 		if x.expr.Kind == common.Term {
 			if x.expr.Value == a.Kind.ToString() {
-				x.parent.Children = append(x.parent.Children, &Node{
-					Expr:  a.ToExpr(),
-					Value: a.Value,
-				})
-				a = lex.NextToken()
-				if a.Kind == lexer.Error {
-					return nil, fmt.Errorf("syntax error: %v", a)
+				if pt.shapes[x.expr] != common.ShapeDrop {
+					x.parent.Children = append(x.parent.Children, &Node{
+						Expr:     a.ToExpr(),
+						Value:    a.Value,
+						Pos:      a.Pos,
+						Doc:      a.Doc,
+						Text:     a.Text,
+						Leading:  skipped + a.Leading,
+						Trailing: a.Trailing,
+						Literal:  a.Literal,
+					})
+					skipped = ""
+				} else {
+					skipped += tokenSource(a)
 				}
-			} else {
-				return nil, fmt.Errorf("unexpected %s, expected: %s", a.Kind.ToString(), x.expr.Value)
+				a = next()
+				quiet = false
+				continue
 			}
-		} else if exprs := table[x.expr][a.ToExpr()]; exprs[0][0] != common.Error {
-			node := Node{
-				Expr: x.expr,
-				Rule: exprs[0],
+		} else if exprs, ok := pt.predict(x.expr, a.ToExpr()); ok {
+			parent := x.parent
+			shape := pt.shapes[x.expr]
+			if !(shape == common.ShapeInline || shape == common.ShapeList && parent.Expr == x.expr) {
+				parent = &Node{
+					Expr:  x.expr,
+					Rule:  exprs,
+					Label: pt.labels[x.expr][a.ToExpr()],
+					Pos:   a.Pos,
+				}
+				x.parent.Children = append(x.parent.Children, parent)
 			}
-			x.parent.Children = append(x.parent.Children, &node)
-			for i := len(exprs[0]) - 1; i >= 0; i-- {
-				if exprs[0][i] != common.Epsilon {
+			for i := len(exprs) - 1; i >= 0; i-- {
+				if exprs[i] != common.Epsilon {
 					st = append(st, stackItem{
-						expr:   exprs[0][i],
-						parent: &node,
+						expr:   exprs[i],
+						parent: parent,
 					})
 				}
 			}
-		} else {
-			return nil, fmt.Errorf("unexpected %s, expected: %s", a.Kind.ToString(), x.expr.Value)
+			continue
 		}
-	}
 
-	// fmt.Println("LAST STACK: ", stack)
-	return fakeRoot.Children[0], nil
-}
-
-func getAllNterms(node *Node, nterms map[common.Expr]struct{}) {
-	if node.Expr.Value == "Nterm" {
-		nterms[common.Expr{
-			Kind:  common.NTerm,
-			Value: node.Value,
-		}] = struct{}{}
-	}
-	if len(node.Children) == 0 {
-		return
-	}
-
-	for _, child := range node.Children {
-		if child.Expr.Value == "Nterm" {
-			nterms[common.Expr{
-				Kind:  common.NTerm,
-				Value: child.Value,
-			}] = struct{}{}
-		} else {
-			getAllNterms(child, nterms)
+		err := fmt.Errorf("unexpected %s, expected: %s", a.Kind.ToString(), x.expr.Value)
+		if !pt.recovers() {
+			return fail(a, err)
 		}
-	}
-}
-
-func getAllTerms(node *Node, terms map[common.Expr]struct{}) {
-	if node.Expr.Value == "Term" {
-		terms[common.Expr{
-			Kind:  common.Term,
-			Value: node.Value,
-		}] = struct{}{}
-	}
-	if len(node.Children) == 0 {
-		return
+		report(a, err)
+		skip(x)
+		resume(x)
 	}
 
-	for _, child := range node.Children {
-		if child.Expr.Value == "Term" {
-			terms[common.Expr{
-				Kind:  common.Term,
-				Value: child.Value,
-			}] = struct{}{}
-		} else {
-			getAllTerms(child, terms)
+	// fmt.Println("LAST STACK: ", stack)
+	if a.Kind != lexer.EOF {
+		err := fmt.Errorf("unexpected %s, expected: %s", a.Kind.ToString(), common.Dollar.Value)
+		if !pt.recovers() {
+			return fail(a, err)
 		}
+		report(a, err)
 	}
-}
-
-func parseRule(node *Node, nterms, terms map[common.Expr]struct{}) ([][]common.Expr, error) {
-	if len(node.Children) == 0 {
-		return [][]common.Expr{}, nil
-	}
-
-	var res [][]common.Expr
-	var exprs []common.Expr
-	v1 := node.Children[0]
-	v2 := node.Children[1]
-	if len(v2.Children) != 0 {
-		v2 = v2.Children[1]
-	}
-	for {
-		if len(v1.Children) == 0 {
-			break
-		}
-		if v1.Children[0].Value == "$EPS" {
-			exprs = append(exprs, common.Epsilon)
+	if len(fakeRoot.Children) > 0 {
+		root := fakeRoot.Children[0]
+		if leaf := lastLeaf(root); leaf != nil {
+			leaf.Trailing += skipped + a.Leading
 		} else {
-			term := common.Expr{
-				Kind:  common.Term,
-				Value: v1.Children[0].Value,
-			}
-			nterm := common.Expr{
-				Kind:  common.NTerm,
-				Value: v1.Children[0].Value,
-			}
-			if _, ok := terms[term]; ok {
-				// if term != common.Dollar {
-				// 	term.Value = v1.Children[0].Value[1 : len(v1.Children[0].Value)-1]
-				// }
-				exprs = append(exprs, term)
-			} else if _, ok := nterms[nterm]; ok {
-				exprs = append(exprs, nterm)
-			} else {
-				return [][]common.Expr{}, fmt.Errorf("unknown token: %v", v1.Children[0])
-			}
-		}
-		if len(v1.Children) > 1 {
-			v1 = v1.Children[1]
-		} else {
-			break
+			root.Leading = skipped + a.Leading
 		}
 	}
-	res = append(res, exprs)
-	rls, err := parseRule(v2, nterms, terms)
-	if err != nil {
-		return [][]common.Expr{}, err
-	}
-	return append(res, rls...), nil
-}
-
-func BuildRules(root *Node) (common.Rules, common.Expr, []common.Expr, error) {
-	calcRules := make(common.Rules)
-	axiom := common.Expr{
-		Kind:  common.NTerm,
-		Value: root.Children[1].Value,
-	}
-
-	nterms := make(map[common.Expr]struct{})
-	getAllNterms(root, nterms)
-
-	terms := make(map[common.Expr]struct{})
-	getAllTerms(root, terms)
-	ruleRoot := root.Children[6]
-	err := buildRules(ruleRoot, calcRules, nterms, terms)
-	if err != nil {
-		return nil, common.Expr{}, nil, err
-	}
-
-	terminals := make([]common.Expr, 0, len(terms))
-	for t := range terms {
-		// t.Value = t.Value[1 : len(t.Value)-1]
-		terminals = append(terminals, t)
-	}
-
-	return calcRules, axiom, terminals, nil
-}
-
-func buildRules(node *Node, rules common.Rules, nterms, terms map[common.Expr]struct{}) error {
-	if len(node.Children) == 0 {
-		return nil
-	}
-	// node.Print()
-	rule := node.Children[0]
-	lhs := common.Expr{
-		Kind:  common.NTerm,
-		Value: rule.Children[1].Value,
-	}
-	rhs, err := parseRule(rule.Children[3], nterms, terms)
-	if err != nil {
-		return err
+	if len(errs) > 0 {
+		errs.sort()
+		var root *Node
+		if len(fakeRoot.Children) > 0 {
+			root = fakeRoot.Children[0]
+		}
+		return root, errs
 	}
-	rules[lhs] = rhs
-	return buildRules(node.Children[1], rules, nterms, terms)
+	return fakeRoot.Children[0], nil
 }
@@ -0,0 +1,269 @@
+package parser
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AlexisOMG/compilers-lab7-2/common"
+	"github.com/AlexisOMG/compilers-lab7-2/lexer"
+)
+
+// buildGrammar builds a grammar from its text and fails on any error.
+func buildGrammar(t *testing.T, text string) *common.Grammar {
+	t.Helper()
+	root, err := parse(lexer.NewStringLexer(text, "grammar.txt", false), grammarTable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, diags := Diagnose(root, Options{})
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	return g
+}
+
+// parseCalc parses input of the calculator lexer with the tables of g.
+func parseCalc(t *testing.T, g *common.Grammar, input, entry string) (*Node, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "table.json")
+	if err := SaveTableInfo(path, g); err != nil {
+		t.Fatal(err)
+	}
+	return Parse(lexer.NewStringLexer(input, "input", true), path, entry)
+}
+
+// treeString renders a tree as Nterm#label(children) with the values of
+// the leaves.
+func treeString(n *Node) string {
+	if n.Expr.Kind != common.NTerm {
+		return n.Value
+	}
+	var sb strings.Builder
+	sb.WriteString(n.Expr.Value)
+	if n.Label != "" {
+		sb.WriteString("#" + n.Label)
+	}
+	sb.WriteString("(")
+	for i, c := range n.Children {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(treeString(c))
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+const labeledGrammar = `$AXIOM E
+$NTERM E' T T' F
+$TERM "+" "*" "(" ")" "n"
+$RULE E  = T E'
+$RULE E' = "+" T E' #add
+           $EPS #end
+$RULE T  = F T'
+$RULE T' = "*" F T' #mul
+           $EPS
+$RULE F  = "n" #num
+           "(" E ")" #paren
+`
+
+func TestLabels(t *testing.T) {
+	g := buildGrammar(t, labeledGrammar)
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "1", want: "E(T(F#num(1) T'()) E'#end())"},
+		{input: "(2)*3", want: "E(T(F#paren(( E(T(F#num(2) T'()) E'#end()) )) T'#mul(* F#num(3) T'())) E'#end())"},
+	}
+
+	for _, test := range tests {
+		root, err := parseCalc(t, g, test.input, "")
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		if got := treeString(root); got != test.want {
+			t.Errorf("%s: tree %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestShapes(t *testing.T) {
+	tests := []struct {
+		name   string
+		shapes string
+		input  string
+		want   string
+	}{
+		{
+			name:  "none",
+			input: "1+2",
+			want:  "E(T(F#num(1) T'()) E'#add(+ T(F#num(2) T'()) E'#end()))",
+		},
+		{
+			name:   "drop",
+			shapes: "$DROP \"(\" \")\" \"+\"\n",
+			input:  "(1)+2",
+			want:   "E(T(F#paren(E(T(F#num(1) T'()) E'#end())) T'()) E'#add(T(F#num(2) T'()) E'#end()))",
+		},
+		{
+			name:   "inline",
+			shapes: "$INLINE T T'\n",
+			input:  "1*2+3",
+			want:   "E(F#num(1) * F#num(2) E'#add(+ F#num(3) E'#end()))",
+		},
+		{
+			name:   "list",
+			shapes: "$LIST E'\n",
+			input:  "1+2+3",
+			want:   "E(T(F#num(1) T'()) E'#add(+ T(F#num(2) T'()) + T(F#num(3) T'())))",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := buildGrammar(t, labeledGrammar+test.shapes)
+			root, err := parseCalc(t, g, test.input, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := treeString(root); got != test.want {
+				t.Errorf("tree %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEntries(t *testing.T) {
+	g := buildGrammar(t, labeledGrammar+"$START F\n")
+	tests := []struct {
+		entry string
+		input string
+		want  string
+		err   string
+	}{
+		{entry: "", input: "1+2", want: "E(T(F#num(1) T'()) E'#add(+ T(F#num(2) T'()) E'#end()))"},
+		{entry: "E", input: "3", want: "E(T(F#num(3) T'()) E'#end())"},
+		{entry: "F", input: "(3)", want: "F#paren(( E(T(F#num(3) T'()) E'#end()) ))"},
+		{entry: "F", input: "1+2", err: "unexpected +, expected: Dollar"},
+		{entry: "T", input: "1", err: "unknown entry point: T"},
+	}
+
+	for _, test := range tests {
+		root, err := parseCalc(t, g, test.input, test.entry)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s from %q: error %v, want %q", test.input, test.entry, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s from %q: %v", test.input, test.entry, err)
+			continue
+		}
+		if got := treeString(root); got != test.want {
+			t.Errorf("%s from %q: tree %s, want %s", test.input, test.entry, got, test.want)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	tests := []struct {
+		name  string
+		sync  string
+		input string
+		want  []string
+		tree  string
+	}{
+		{
+			name:  "no sync",
+			input: "1 + * 2 + 3",
+			want:  []string{"input:1:5: unexpected *, expected: T"},
+		},
+		{
+			name:  "no sync, lexical error after",
+			input: "1 + * 2 ! 3",
+			want: []string{
+				"input:1:5: error: unexpected *, expected: T",
+				"input:1:9: error: unexpected character '!'",
+			},
+		},
+		{
+			name:  "global",
+			sync:  "$SYNC \"+\"\n",
+			input: "1 + * 2 + 3",
+			want:  []string{"input:1:5: error: unexpected *, expected: T"},
+			tree:  "E(T(F#num(1) T'()) E'#add(+ T(F#num(2) T'()) E'#add(+ T(F#num(3) T'()) E'#end())))",
+		},
+		{
+			name:  "per nonterminal",
+			sync:  "$SYNC F \")\"\n",
+			input: "(1 2) + (3 * ) + 4",
+			want: []string{
+				"input:1:4: error: unexpected n, expected: T'",
+				"input:1:14: error: unexpected ), expected: F",
+			},
+			tree: "E(T(F#paren(( E(T(F#num(1) T'()) E'#end()) )) T'()) E'#add(+ T(F#paren(( E(T(F#num(3) T'#mul(* T'())) E'#end()) )) T'()) E'#add(+ T(F#num(4) T'()) E'#end())))",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := buildGrammar(t, labeledGrammar+test.sync)
+			root, err := parseCalc(t, g, test.input, "")
+			if err == nil {
+				t.Fatal("no syntax error")
+			}
+			if got, want := err.Error(), strings.Join(test.want, "\n"); got != want {
+				t.Errorf("errors:\n%s\nwant:\n%s", got, want)
+			}
+			if test.tree == "" {
+				return
+			}
+			if root == nil {
+				t.Fatal("no tree after recovery")
+			}
+			if got := treeString(root); got != test.tree {
+				t.Errorf("tree %s, want %s", got, test.tree)
+			}
+		})
+	}
+}
+
+func TestSource(t *testing.T) {
+	for _, file := range []string{"../test.txt", "../selfmade.txt"} {
+		text, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lex := lexer.NewStringLexer(string(text), file, false)
+		lex.(lexer.TriviaKeeper).KeepTrivia()
+		root, err := parse(lex, grammarTable())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := root.Source(); got != string(text) {
+			t.Errorf("%s: source differs:\n%s", file, got)
+		}
+	}
+
+	g := buildGrammar(t, labeledGrammar+"$SYNC \"+\"\n")
+	path := filepath.Join(t.TempDir(), "table.json")
+	if err := SaveTableInfo(path, g); err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range []string{"  1 +(2* 3)\n\n", "1 + * 2 + 3 "} {
+		lex := lexer.NewStringLexer(input, "input", true)
+		lex.(lexer.TriviaKeeper).KeepTrivia()
+		root, _ := Parse(lex, path, "")
+		if root == nil {
+			t.Fatalf("%q: no tree", input)
+		}
+		if got := root.Source(); got != input {
+			t.Errorf("source %q, want %q", got, input)
+		}
+	}
+}